@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"github.com/vkobazev/goShortenerUrl/internal/config"
+	"github.com/vkobazev/goShortenerUrl/internal/storage"
+	"log"
+)
+
+// runCompact snapshots the event file and truncates it. The server must not
+// be running on the same file. The storage is closed before returning, so
+// the caller may exit on the error.
+func runCompact() (err error) {
+	s, err := storage.NewFile(config.Options.FileStoragePath, config.FileOptions())
+	if err != nil {
+		return fmt.Errorf("restoring data from events: %w", err)
+	}
+	defer func() {
+		if cerr := s.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("closing event file: %w", cerr)
+		}
+	}()
+
+	if err := s.Compact(); err != nil {
+		return fmt.Errorf("compacting event file: %w", err)
+	}
+	log.Printf("Compacted %s", config.Options.FileStoragePath)
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/vkobazev/goShortenerUrl/internal/config"
+	"github.com/vkobazev/goShortenerUrl/internal/data"
+	"log"
+)
+
+const convertUsage = "usage: shortener convert [-f <file>] json|binary [<dst>]"
+
+// runConvert rewrites the event file in another format, in place unless a
+// destination is given. The server must not be running on the same file.
+func runConvert(args []string) {
+	if len(args) == 0 || len(args) > 2 {
+		log.Fatal(convertUsage)
+	}
+	format, err := data.ParseFormat(args[0])
+	if err != nil {
+		log.Fatalf("%v: %s", err, convertUsage)
+	}
+
+	src := config.Options.FileStoragePath
+	dst := src
+	if len(args) == 2 {
+		dst = args[1]
+	}
+
+	if err := data.Convert(src, dst, format); err != nil {
+		log.Fatalf("Error converting %s: %v", src, err)
+	}
+	log.Printf("Converted %s to %s format in %s", src, format, dst)
+}
@@ -1,19 +1,50 @@
 package main
 
 import (
+	"flag"
 	"github.com/vkobazev/goShortenerUrl/internal/config"
 	"github.com/vkobazev/goShortenerUrl/internal/webserver"
 	"log"
+	"os"
+	"strings"
 )
 
 func main() {
 
+	// Subcommand, if any, goes before flags: shortener migrate -d <dsn> up
+	command := ""
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		command = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
 	// Parse Flags to set up Server
 	err := config.ConfigService()
 	if err != nil {
-		log.Fatal("Can't parse port as string value")
+		log.Fatalf("Can't parse config: %v", err)
 	}
 
-	// Start Web Server
-	webserver.StartWebServer()
+	switch command {
+	case "":
+		// Start Web Server
+		webserver.StartWebServer()
+	case "migrate":
+		runMigrate(flag.Args())
+	case "compact":
+		if err := runCompact(); err != nil {
+			log.Fatalf("Compact failed: %v", err)
+		}
+	case "convert":
+		runConvert(flag.Args())
+	case "export":
+		if err := runExport(flag.Args()); err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+	case "import":
+		if err := runImport(flag.Args()); err != nil {
+			log.Fatalf("Import failed: %v", err)
+		}
+	default:
+		log.Fatalf("Unknown command %q", command)
+	}
 }
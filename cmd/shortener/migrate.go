@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/vkobazev/goShortenerUrl/internal/config"
+	"github.com/vkobazev/goShortenerUrl/internal/database"
+	"log"
+	"strconv"
+)
+
+const migrateUsage = "usage: shortener migrate -d <dsn> up | down [N] | status"
+
+// runMigrate manages the PostgreSQL schema without starting the server.
+func runMigrate(args []string) {
+	if config.Options.DataBaseConn == "" {
+		log.Fatal("Database connection string is required: ", migrateUsage)
+	}
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	db, err := database.New(config.Options.DataBaseConn)
+	if err != nil {
+		log.Fatalf("Error connecting to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		err = db.MigrateUp(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatal(migrateUsage)
+			}
+		}
+		err = db.MigrateDown(ctx, steps)
+	case "status":
+		err = printMigrateStatus(ctx, db)
+	default:
+		log.Fatal(migrateUsage)
+	}
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+}
+
+func printMigrateStatus(ctx context.Context, db *database.DB) error {
+	current, err := db.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	migrations, err := database.Migrations()
+	if err != nil {
+		return err
+	}
+
+	for _, mig := range migrations {
+		state := "pending"
+		if mig.Version <= current {
+			state = "applied"
+		}
+		fmt.Printf("%04d_%s\t%s\n", mig.Version, mig.Name, state)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/vkobazev/goShortenerUrl/internal/transfer"
+	"github.com/vkobazev/goShortenerUrl/internal/webserver"
+	"io"
+	"log"
+	"os"
+)
+
+const (
+	exportUsage = "usage: shortener export [storage flags] ndjson|csv [<file>]"
+	importUsage = "usage: shortener import [storage flags] ndjson|csv [<file>]"
+)
+
+// runExport writes every link of the configured storage to a file or stdout.
+// The file and the storage are closed before returning, so the caller may
+// exit on the error.
+func runExport(args []string) (err error) {
+	format, path := transferArgs(args, exportUsage)
+
+	var w io.Writer = os.Stdout
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("creating %s: %w", path, err)
+		}
+		defer closeOnReturn(file, &err)
+		w = file
+	}
+
+	s := webserver.SetupStorage()
+	defer closeOnReturn(s, &err)
+
+	n, err := transfer.Export(context.Background(), s, w, format)
+	if err != nil {
+		return fmt.Errorf("exporting links: %w", err)
+	}
+	log.Printf("Exported %d links", n)
+	return nil
+}
+
+// runImport stores links read from a file or stdin in the configured
+// storage, keeping their short IDs. The storage is closed before returning,
+// so what was imported is synced even on an error.
+func runImport(args []string) (err error) {
+	format, path := transferArgs(args, importUsage)
+
+	var r io.Reader = os.Stdin
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("opening %s: %w", path, err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	s := webserver.SetupStorage()
+	defer closeOnReturn(s, &err)
+
+	n, err := transfer.Import(context.Background(), s, r, format)
+	if err != nil {
+		return fmt.Errorf("importing links after %d records: %w", n, err)
+	}
+	log.Printf("Imported %d links", n)
+	return nil
+}
+
+// closeOnReturn closes c and reports its error in *err unless an earlier
+// error is already there.
+func closeOnReturn(c io.Closer, err *error) {
+	if cerr := c.Close(); *err == nil && cerr != nil {
+		*err = cerr
+	}
+}
+
+func transferArgs(args []string, usage string) (transfer.Format, string) {
+	if len(args) == 0 || len(args) > 2 {
+		log.Fatal(usage)
+	}
+	format, err := transfer.ParseFormat(args[0])
+	if err != nil {
+		log.Fatalf("%v: %s", err, usage)
+	}
+	if len(args) == 2 {
+		return format, args[1]
+	}
+	return format, ""
+}
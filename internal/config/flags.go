@@ -2,18 +2,45 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"github.com/vkobazev/goShortenerUrl/internal/consts"
+	"github.com/vkobazev/goShortenerUrl/internal/data"
+	"github.com/vkobazev/goShortenerUrl/internal/idgen"
+	"net/http"
 	"os"
+	"strconv"
+	"time"
 )
 
 var Options struct {
-	DefScheme       string
-	DefHost         string
-	DefPort         string
-	ListenAddr      string
-	ReturnAddr      string
-	FileStoragePath string
-	DataBaseConn    string
+	DefScheme        string
+	DefHost          string
+	DefPort          string
+	ListenAddr       string
+	ReturnAddr       string
+	FileStoragePath  string
+	DataBaseConn     string
+	SQLitePath       string
+	SnapshotInterval time.Duration
+	FileFormat       string
+	FileSync         string
+	FileSyncInterval time.Duration
+	CacheSize        int
+	CacheTTL         time.Duration
+	QueryTimeout     time.Duration
+	DeleteQueuePath  string
+	ShutdownTimeout  time.Duration
+	PurgeAfter       time.Duration
+	PurgeInterval    time.Duration
+	IDGenerator      string
+	IDSalt           string
+	IDLength         int
+	IDAlphabet       string
+	IDGrowAt         float64
+	IDUnambiguous    bool
+	IDBlocklist      string
+	Redirect         int
+	RedirectMaxAge   time.Duration
 	//DBHost          string
 	//DBPort          int
 	//DBUser          string
@@ -31,6 +58,27 @@ func ConfigService() error {
 	flag.StringVar(&Options.ReturnAddr, "b", "http://localhost:8080", "Return address")
 	flag.StringVar(&Options.FileStoragePath, "f", "./data.json", "File storage path")
 	flag.StringVar(&Options.DataBaseConn, "d", "", "Database connection string")
+	flag.StringVar(&Options.SQLitePath, "s", "", "SQLite database path")
+	flag.DurationVar(&Options.SnapshotInterval, "snapshot-interval", 0, "File storage compaction interval, 0 disables it")
+	flag.StringVar(&Options.FileFormat, "file-format", "json", "File storage format for new files: json or binary")
+	flag.StringVar(&Options.FileSync, "fsync", "interval", "File storage fsync policy: always, interval or never")
+	flag.DurationVar(&Options.FileSyncInterval, "fsync-interval", time.Second, "File storage fsync interval for the interval policy")
+	flag.IntVar(&Options.CacheSize, "cache-size", 10000, "Redirect cache size for database storage, 0 disables it")
+	flag.DurationVar(&Options.CacheTTL, "cache-ttl", time.Minute, "Redirect cache entry lifetime")
+	flag.DurationVar(&Options.QueryTimeout, "query-timeout", 3*time.Second, "Database query timeout, 0 disables it")
+	flag.StringVar(&Options.DeleteQueuePath, "delete-queue", "./delete_queue.json", "Deletion queue journal path, empty keeps the queue in memory")
+	flag.DurationVar(&Options.ShutdownTimeout, "shutdown-timeout", 10*time.Second, "How long to drain requests and deletions on shutdown")
+	flag.DurationVar(&Options.PurgeAfter, "purge-after", 0, "How long deleted links are kept before they are purged for good, 0 keeps them forever")
+	flag.DurationVar(&Options.PurgeInterval, "purge-interval", time.Hour, "How often deleted links are purged")
+	flag.StringVar(&Options.IDGenerator, "id-generator", "random", "Short ID generator: random, counter, hashids or hash")
+	flag.StringVar(&Options.IDSalt, "id-salt", "", "Salt of the hashids ID generator")
+	flag.IntVar(&Options.IDLength, "id-length", consts.ShortURLLength, "Short ID length, the minimum for hashids; counter IDs grow from one character and ignore it")
+	flag.StringVar(&Options.IDAlphabet, "id-alphabet", idgen.Alphabet, "Characters short IDs are made of")
+	flag.Float64Var(&Options.IDGrowAt, "id-grow-at", 0.01, "Share of taken IDs at which random and hash IDs get longer, 0 keeps the length fixed")
+	flag.BoolVar(&Options.IDUnambiguous, "id-unambiguous", false, "Leave lookalike characters such as 0, O, 1 and l out of short IDs")
+	flag.StringVar(&Options.IDBlocklist, "id-blocklist", "", "File of words kept out of short IDs and aliases, empty uses the built-in list")
+	flag.IntVar(&Options.Redirect, "redirect", http.StatusTemporaryRedirect, "Default redirect status code: 301, 302, 307 or 308")
+	flag.DurationVar(&Options.RedirectMaxAge, "redirect-max-age", 24*time.Hour, "How long clients may cache permanent redirects")
 	flag.Parse()
 
 	if addr := os.Getenv("SERVER_ADDRESS"); addr != "" {
@@ -45,5 +93,183 @@ func ConfigService() error {
 	if DataBaseConn := os.Getenv("DATABASE_DSN"); DataBaseConn != "" {
 		Options.DataBaseConn = DataBaseConn
 	}
+	if SQLitePath := os.Getenv("SQLITE_PATH"); SQLitePath != "" {
+		Options.SQLitePath = SQLitePath
+	}
+	if SnapshotInterval := os.Getenv("FILE_SNAPSHOT_INTERVAL"); SnapshotInterval != "" {
+		d, err := time.ParseDuration(SnapshotInterval)
+		if err != nil {
+			return fmt.Errorf("invalid FILE_SNAPSHOT_INTERVAL: %w", err)
+		}
+		Options.SnapshotInterval = d
+	}
+	if FileFormat := os.Getenv("FILE_FORMAT"); FileFormat != "" {
+		Options.FileFormat = FileFormat
+	}
+	if FileSync := os.Getenv("FILE_FSYNC"); FileSync != "" {
+		Options.FileSync = FileSync
+	}
+	if FileSyncInterval := os.Getenv("FILE_FSYNC_INTERVAL"); FileSyncInterval != "" {
+		d, err := time.ParseDuration(FileSyncInterval)
+		if err != nil {
+			return fmt.Errorf("invalid FILE_FSYNC_INTERVAL: %w", err)
+		}
+		Options.FileSyncInterval = d
+	}
+	if CacheSize := os.Getenv("CACHE_SIZE"); CacheSize != "" {
+		n, err := strconv.Atoi(CacheSize)
+		if err != nil {
+			return fmt.Errorf("invalid CACHE_SIZE: %w", err)
+		}
+		Options.CacheSize = n
+	}
+	if CacheTTL := os.Getenv("CACHE_TTL"); CacheTTL != "" {
+		d, err := time.ParseDuration(CacheTTL)
+		if err != nil {
+			return fmt.Errorf("invalid CACHE_TTL: %w", err)
+		}
+		Options.CacheTTL = d
+	}
+	if QueryTimeout := os.Getenv("QUERY_TIMEOUT"); QueryTimeout != "" {
+		d, err := time.ParseDuration(QueryTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid QUERY_TIMEOUT: %w", err)
+		}
+		Options.QueryTimeout = d
+	}
+	if DeleteQueuePath, ok := os.LookupEnv("DELETE_QUEUE_PATH"); ok {
+		Options.DeleteQueuePath = DeleteQueuePath
+	}
+	if ShutdownTimeout := os.Getenv("SHUTDOWN_TIMEOUT"); ShutdownTimeout != "" {
+		d, err := time.ParseDuration(ShutdownTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid SHUTDOWN_TIMEOUT: %w", err)
+		}
+		Options.ShutdownTimeout = d
+	}
+	if PurgeAfter := os.Getenv("PURGE_AFTER"); PurgeAfter != "" {
+		d, err := time.ParseDuration(PurgeAfter)
+		if err != nil {
+			return fmt.Errorf("invalid PURGE_AFTER: %w", err)
+		}
+		Options.PurgeAfter = d
+	}
+	if PurgeInterval := os.Getenv("PURGE_INTERVAL"); PurgeInterval != "" {
+		d, err := time.ParseDuration(PurgeInterval)
+		if err != nil {
+			return fmt.Errorf("invalid PURGE_INTERVAL: %w", err)
+		}
+		Options.PurgeInterval = d
+	}
+	if IDGenerator := os.Getenv("ID_GENERATOR"); IDGenerator != "" {
+		Options.IDGenerator = IDGenerator
+	}
+	if IDSalt := os.Getenv("ID_SALT"); IDSalt != "" {
+		Options.IDSalt = IDSalt
+	}
+	if IDLength := os.Getenv("ID_LENGTH"); IDLength != "" {
+		n, err := strconv.Atoi(IDLength)
+		if err != nil {
+			return fmt.Errorf("invalid ID_LENGTH: %w", err)
+		}
+		Options.IDLength = n
+	}
+	if IDAlphabet := os.Getenv("ID_ALPHABET"); IDAlphabet != "" {
+		Options.IDAlphabet = IDAlphabet
+	}
+	if IDGrowAt := os.Getenv("ID_GROW_AT"); IDGrowAt != "" {
+		f, err := strconv.ParseFloat(IDGrowAt, 64)
+		if err != nil {
+			return fmt.Errorf("invalid ID_GROW_AT: %w", err)
+		}
+		Options.IDGrowAt = f
+	}
+	if IDUnambiguous := os.Getenv("ID_UNAMBIGUOUS"); IDUnambiguous != "" {
+		b, err := strconv.ParseBool(IDUnambiguous)
+		if err != nil {
+			return fmt.Errorf("invalid ID_UNAMBIGUOUS: %w", err)
+		}
+		Options.IDUnambiguous = b
+	}
+	if IDBlocklist := os.Getenv("ID_BLOCKLIST"); IDBlocklist != "" {
+		Options.IDBlocklist = IDBlocklist
+	}
+	if Redirect := os.Getenv("REDIRECT_STATUS"); Redirect != "" {
+		n, err := strconv.Atoi(Redirect)
+		if err != nil {
+			return fmt.Errorf("invalid REDIRECT_STATUS: %w", err)
+		}
+		Options.Redirect = n
+	}
+	if RedirectMaxAge := os.Getenv("REDIRECT_MAX_AGE"); RedirectMaxAge != "" {
+		d, err := time.ParseDuration(RedirectMaxAge)
+		if err != nil {
+			return fmt.Errorf("invalid REDIRECT_MAX_AGE: %w", err)
+		}
+		Options.RedirectMaxAge = d
+	}
+	if !ValidRedirect(Options.Redirect) {
+		return fmt.Errorf("redirect status must be 301, 302, 307 or 308, got %d", Options.Redirect)
+	}
+	if Options.RedirectMaxAge < 0 {
+		return fmt.Errorf("redirect max age must not be negative, got %s", Options.RedirectMaxAge)
+	}
+	if Options.PurgeAfter > 0 && Options.PurgeInterval <= 0 {
+		return fmt.Errorf("purge interval must be positive, got %s", Options.PurgeInterval)
+	}
+	if _, err := idgen.ParseStrategy(Options.IDGenerator); err != nil {
+		return err
+	}
+	if Options.IDLength <= 0 {
+		return fmt.Errorf("ID length must be positive, got %d", Options.IDLength)
+	}
+	if Options.IDGrowAt < 0 || Options.IDGrowAt >= 1 {
+		return fmt.Errorf("ID growth threshold must be in [0, 1), got %g", Options.IDGrowAt)
+	}
+	if err := idgen.ValidateAlphabet(IDAlphabet()); err != nil {
+		return err
+	}
+	if _, err := data.ParseFormat(Options.FileFormat); err != nil {
+		return err
+	}
+	mode, err := data.ParseSyncMode(Options.FileSync)
+	if err != nil {
+		return err
+	}
+	if mode == data.SyncInterval && Options.FileSyncInterval <= 0 {
+		return fmt.Errorf("fsync interval must be positive, got %s", Options.FileSyncInterval)
+	}
 	return nil
 }
+
+// IDAlphabet returns the characters short IDs are made of.
+func IDAlphabet() string {
+	if Options.IDUnambiguous {
+		return idgen.Unambiguous(Options.IDAlphabet)
+	}
+	return Options.IDAlphabet
+}
+
+// ValidRedirect reports whether code is a status a link may redirect with.
+func ValidRedirect(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	default:
+		return false
+	}
+}
+
+// FileOptions returns the format and fsync policy of the file storage
+// event log.
+func FileOptions() data.Options {
+	format, _ := data.ParseFormat(Options.FileFormat)
+	mode, _ := data.ParseSyncMode(Options.FileSync)
+	return data.Options{
+		Format: format,
+		Sync: data.SyncPolicy{
+			Mode:     mode,
+			Interval: Options.FileSyncInterval,
+		},
+	}
+}
@@ -0,0 +1,243 @@
+package data
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"time"
+)
+
+// A binary event file starts with an 8 byte header: the magic "SHEV", a
+// format version and three reserved bytes. Each event follows as a frame:
+//
+//	uint32 payload length | uint32 CRC-32C of payload | payload
+//
+// with integers in big-endian order. The payload holds the event type code,
+// the ID as a uvarint, then Short, Long and UserID, each prefixed with its
+// length as a uvarint, then CreatedAt and DeletedAt as Unix nanoseconds in
+// uvarints, then Redirect as a uvarint.
+// Decoders treat fields missing at the end of a payload as zero, so later
+// versions can append fields.
+
+const (
+	binaryMagic      = "SHEV"
+	binaryVersion    = 1
+	binaryHeaderSize = 8
+	frameHeaderSize  = 8
+	maxFrameSize     = 1 << 20
+)
+
+var eventTypeCodes = map[EventType]byte{
+	"":           0,
+	EventCreated: 1,
+	EventUpdated: 2,
+	EventDeleted: 3,
+}
+
+var errTruncatedPayload = errors.New("truncated payload")
+
+func binaryHeader() []byte {
+	header := make([]byte, binaryHeaderSize)
+	copy(header, binaryMagic)
+	header[len(binaryMagic)] = binaryVersion
+	return header
+}
+
+// encodeFrame returns event as a binary frame.
+func encodeFrame(event *Event) ([]byte, error) {
+	code, ok := eventTypeCodes[event.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown event type %q", event.Type)
+	}
+
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+16+len(event.Short)+len(event.Long)+len(event.UserID))
+	frame = append(frame, code)
+	frame = binary.AppendUvarint(frame, uint64(event.ID))
+	frame = appendString(frame, event.Short)
+	frame = appendString(frame, event.Long)
+	frame = appendString(frame, event.UserID)
+	var createdAt uint64
+	if event.CreatedAt != nil {
+		createdAt = uint64(event.CreatedAt.UnixNano())
+	}
+	frame = binary.AppendUvarint(frame, createdAt)
+	var deletedAt uint64
+	if event.DeletedAt != nil {
+		deletedAt = uint64(event.DeletedAt.UnixNano())
+	}
+	frame = binary.AppendUvarint(frame, deletedAt)
+	frame = binary.AppendUvarint(frame, uint64(event.Redirect))
+
+	payload := frame[frameHeaderSize:]
+	if len(payload) > maxFrameSize {
+		return nil, fmt.Errorf("event %s is too large: %d bytes", event.Short, len(payload))
+	}
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.Checksum(payload, crcTable))
+	return frame, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// payloadReader reads fields from a frame payload. Once the payload is
+// exhausted every further field reads as zero.
+type payloadReader struct {
+	b   []byte
+	err error
+}
+
+func (r *payloadReader) byte() byte {
+	if len(r.b) == 0 {
+		return 0
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v
+}
+
+func (r *payloadReader) uvarint() uint64 {
+	if len(r.b) == 0 {
+		return 0
+	}
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.err = errTruncatedPayload
+		r.b = nil
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *payloadReader) string() string {
+	n := r.uvarint()
+	if n > uint64(len(r.b)) {
+		r.err = errTruncatedPayload
+		r.b = nil
+		return ""
+	}
+	s := string(r.b[:n])
+	r.b = r.b[n:]
+	return s
+}
+
+func decodePayload(payload []byte) (Event, error) {
+	r := &payloadReader{b: payload}
+
+	code := r.byte()
+	var event Event
+	found := false
+	for eventType, c := range eventTypeCodes {
+		if c == code {
+			event.Type, found = eventType, true
+			break
+		}
+	}
+	if !found {
+		return Event{}, fmt.Errorf("unknown event type code %d", code)
+	}
+
+	event.ID = uint(r.uvarint())
+	event.Short = r.string()
+	event.Long = r.string()
+	event.UserID = r.string()
+	if nanos := r.uvarint(); nanos != 0 {
+		createdAt := time.Unix(0, int64(nanos)).UTC()
+		event.CreatedAt = &createdAt
+	}
+	if nanos := r.uvarint(); nanos != 0 {
+		deletedAt := time.Unix(0, int64(nanos)).UTC()
+		event.DeletedAt = &deletedAt
+	}
+	event.Redirect = int(r.uvarint())
+	if r.err != nil {
+		return Event{}, r.err
+	}
+	return event, nil
+}
+
+func (c *Consumer) readBinary() ([]Event, repair, error) {
+	header := make([]byte, binaryHeaderSize)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			// Crashed while writing the header of a new file
+			log.Printf("Dropping incomplete header of %s", c.file.Name())
+			return nil, repair{needed: true, size: 0}, nil
+		}
+		return nil, repair{}, err
+	}
+	if version := header[len(binaryMagic)]; version > binaryVersion {
+		return nil, repair{}, fmt.Errorf("%s has binary format version %d, newest supported is %d",
+			c.file.Name(), version, binaryVersion)
+	}
+
+	var events []Event
+	var offset, good int64 = binaryHeaderSize, binaryHeaderSize
+	var frame, badFrame int // badFrame is the last corrupted frame seen
+	var badErr error
+	torn := false
+
+	frameHeader := make([]byte, frameHeaderSize)
+	for {
+		_, err := io.ReadFull(c.reader, frameHeader)
+		if err == io.EOF {
+			break // Достигнут конец файла
+		}
+		if err == io.ErrUnexpectedEOF {
+			torn, badErr = true, err
+			break
+		}
+		if err != nil {
+			return nil, repair{}, err
+		}
+		frame++
+
+		size := binary.BigEndian.Uint32(frameHeader[0:4])
+		if size > maxFrameSize {
+			// The length itself is corrupted, the next frame can't be found
+			torn, badErr = true, fmt.Errorf("frame %d claims %d bytes", frame, size)
+			break
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(c.reader, payload); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				torn, badErr = true, io.ErrUnexpectedEOF
+				break
+			}
+			return nil, repair{}, err
+		}
+		offset += frameHeaderSize + int64(size)
+
+		var event Event
+		if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(frameHeader[4:8]) {
+			err = errChecksum
+		} else {
+			event, err = decodePayload(payload)
+		}
+		if badFrame != 0 {
+			// A frame follows, so the corrupted one is not the tail
+			log.Printf("Skipping corrupted event frame %d of %s: %v", badFrame, c.file.Name(), badErr)
+			badFrame = 0
+		}
+		if err != nil {
+			badFrame, badErr = frame, err
+			continue
+		}
+		events = append(events, event)
+		good = offset
+	}
+
+	if torn || badFrame != 0 {
+		log.Printf("Dropping corrupted tail of %s after byte %d: %v", c.file.Name(), good, badErr)
+	}
+	return events, repair{
+		needed: torn || good != offset,
+		size:   good,
+	}, nil
+}
@@ -0,0 +1,174 @@
+package data
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var binaryOpts = Options{Format: FormatBinary}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "data.bin")
+	deletedAt := time.Date(2024, 9, 26, 14, 46, 13, 0, time.UTC)
+	want := []Event{
+		{Type: EventCreated, ID: 1, Short: "a", Long: "https://a", UserID: "u"},
+		{Type: EventUpdated, ID: 2, Short: "a", Long: "https://b", UserID: "v", Redirect: 308},
+		{Type: EventDeleted, Short: "a", UserID: "v", DeletedAt: &deletedAt},
+		{ID: 3, Short: "legacy", Long: "https://legacy", UserID: "u"},
+	}
+	writeEvents(t, fileName, binaryOpts, want[:2]...)
+	// Reopening appends frames after the existing header
+	writeEvents(t, fileName, binaryOpts, want[2:]...)
+
+	assert.Equal(t, want, readEvents(t, fileName))
+}
+
+func TestBinaryFormatMismatch(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "data.json")
+	writeEvents(t, fileName, Options{}, Event{Type: EventCreated, ID: 1, Short: "a"})
+
+	_, err := NewProducer(fileName, binaryOpts)
+	assert.Error(t, err)
+}
+
+func TestBinaryRecovery(t *testing.T) {
+	frame := func(short string) []byte {
+		b, err := encodeFrame(&Event{Type: EventCreated, ID: 1, Short: short, Long: "https://" + short, UserID: "u"})
+		require.NoError(t, err)
+		return b
+	}
+	corrupt := func(b []byte) []byte {
+		b = append([]byte(nil), b...)
+		b[len(b)-1] ^= 0xff
+		return b
+	}
+	join := func(parts ...[]byte) []byte {
+		b := binaryHeader()
+		for _, p := range parts {
+			b = append(b, p...)
+		}
+		return b
+	}
+
+	tests := []struct {
+		name     string
+		content  []byte
+		want     []string
+		wantFile []byte
+	}{
+		{
+			name:     "torn frame is truncated",
+			content:  join(frame("a"), frame("b")[:5]),
+			want:     []string{"a"},
+			wantFile: join(frame("a")),
+		},
+		{
+			name:     "checksum mismatch at the tail is truncated",
+			content:  join(frame("a"), corrupt(frame("b"))),
+			want:     []string{"a"},
+			wantFile: join(frame("a")),
+		},
+		{
+			name:     "corrupted frame in the middle is skipped",
+			content:  join(frame("a"), corrupt(frame("b")), frame("c")),
+			want:     []string{"a", "c"},
+			wantFile: join(frame("a"), corrupt(frame("b")), frame("c")),
+		},
+		{
+			name:     "incomplete header is dropped",
+			content:  binaryHeader()[:6],
+			want:     nil,
+			wantFile: []byte{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "data.bin")
+			require.NoError(t, os.WriteFile(fileName, tt.content, 0666))
+
+			assert.Equal(t, tt.want, shorts(readEvents(t, fileName)))
+
+			b, err := os.ReadFile(fileName)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantFile, b)
+
+			writeEvents(t, fileName, binaryOpts, Event{Type: EventCreated, ID: 9, Short: "z"})
+			assert.Equal(t, append(tt.want, "z"), shorts(readEvents(t, fileName)))
+		})
+	}
+}
+
+func TestDecodePayloadTrailingFields(t *testing.T) {
+	b, err := encodeFrame(&Event{Type: EventCreated, ID: 7, Short: "a", Long: "https://a", UserID: "u"})
+	require.NoError(t, err)
+	payload := b[frameHeaderSize:]
+
+	// Fields appended by a later version are ignored
+	event, err := decodePayload(append(payload, 0x05, 0x01))
+	require.NoError(t, err)
+	assert.Equal(t, "u", event.UserID)
+
+	// Fields missing from the end read as zero
+	event, err = decodePayload(payload[:2])
+	require.NoError(t, err)
+	assert.Equal(t, Event{Type: EventCreated, ID: 7}, event)
+}
+
+func TestConvert(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "data.json")
+	want := []Event{
+		{Type: EventCreated, ID: 1, Short: "a", Long: "https://a", UserID: "u"},
+		{Type: EventDeleted, Short: "a", UserID: "u"},
+	}
+	writeEvents(t, src, Options{}, want...)
+
+	bin := filepath.Join(dir, "data.bin")
+	require.NoError(t, Convert(src, bin, FormatBinary))
+	assert.Equal(t, want, readEvents(t, bin))
+
+	// Back to JSON in place
+	require.NoError(t, Convert(bin, bin, FormatJSON))
+	got := readEvents(t, bin)
+	for i := range got {
+		got[i].Checksum = 0
+	}
+	assert.Equal(t, want, got)
+}
+
+func BenchmarkReadAllEvents(b *testing.B) {
+	for _, format := range []Format{FormatJSON, FormatBinary} {
+		b.Run(string(format), func(b *testing.B) {
+			fileName := filepath.Join(b.TempDir(), "data")
+			p, err := NewProducer(fileName, Options{Format: format})
+			require.NoError(b, err)
+			for i := 0; i < 10000; i++ {
+				err := p.WriteEvent(&Event{
+					Type:   EventCreated,
+					ID:     uint(i + 1),
+					Short:  fmt.Sprintf("%06d", i),
+					Long:   fmt.Sprintf("https://example.com/some/long/path/%d", i),
+					UserID: "123456",
+				})
+				require.NoError(b, err)
+			}
+			require.NoError(b, p.Close())
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c, err := NewConsumer(fileName)
+				require.NoError(b, err)
+				_, err = c.ReadAllEvents()
+				require.NoError(b, err)
+				c.Close()
+			}
+		})
+	}
+}
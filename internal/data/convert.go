@@ -0,0 +1,42 @@
+package data
+
+import (
+	"os"
+)
+
+// Convert rewrites the events of src into dst using format. src and dst may
+// be the same file, which is then replaced atomically.
+func Convert(src, dst string, format Format) error {
+	consumer, err := NewConsumer(src)
+	if err != nil {
+		return err
+	}
+	events, err := consumer.ReadAllEvents()
+	consumer.Close()
+	if err != nil {
+		return err
+	}
+
+	tmp := dst + ".tmp"
+	os.Remove(tmp)
+
+	p, err := NewProducer(tmp, Options{Format: format})
+	if err != nil {
+		return err
+	}
+	for i := range events {
+		if err := p.WriteEvent(&events[i]); err != nil {
+			p.Close()
+			return err
+		}
+	}
+	if err := p.Sync(); err != nil {
+		p.Close()
+		return err
+	}
+	if err := p.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, dst)
+}
@@ -1,48 +1,220 @@
 package data
 
 import (
-	"encoding/json"
+	"bufio"
+	"bytes"
+	"fmt"
 	"io"
+	"log"
 	"os"
+	"sync/atomic"
+	"time"
+)
+
+// EventType tells how an event changes the link it refers to.
+type EventType string
+
+const (
+	// EventCreated adds a new link. Events written before event types were
+	// introduced have no type and are treated as created.
+	EventCreated EventType = "created"
+	// EventUpdated overwrites the URL, owner and redirect of an existing
+	// link and clears its deletion.
+	EventUpdated EventType = "updated"
+	// EventDeleted marks a link of UserID as deleted.
+	EventDeleted EventType = "deleted"
 )
 
 type Event struct {
-	ID     uint   `json:"id"`
-	Short  string `json:"short_url"`
-	Long   string `json:"original_url"`
-	UserID string `json:"user_id"`
+	Type   EventType `json:"type,omitempty"`
+	ID     uint      `json:"id,omitempty"`
+	Short  string    `json:"short_url"`
+	Long   string    `json:"original_url,omitempty"`
+	UserID string    `json:"user_id"`
+	// CreatedAt is set on created events; older events have none.
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	// DeletedAt is set on deleted events; older events have none.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Redirect is the status code of created and updated links, 0 for the
+	// server default.
+	Redirect int `json:"redirect,omitempty"`
+	// Checksum is the CRC-32C of the record encoded with Checksum set to
+	// zero. Records written before checksums were introduced have none.
+	// Binary files checksum whole frames instead and leave it zero.
+	Checksum uint32 `json:"crc,omitempty"`
+}
+
+// Format is the encoding of an event file.
+type Format string
+
+const (
+	// FormatJSON writes one JSON object per line.
+	FormatJSON Format = "json"
+	// FormatBinary writes a header followed by length-prefixed frames.
+	FormatBinary Format = "binary"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch format := Format(s); format {
+	case FormatJSON, FormatBinary:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown event file format %q, want json or binary", s)
+	}
+}
+
+// SyncMode tells when a Producer flushes events to stable storage.
+type SyncMode string
+
+const (
+	// SyncAlways syncs after every event.
+	SyncAlways SyncMode = "always"
+	// SyncInterval syncs in the background at most once per interval.
+	SyncInterval SyncMode = "interval"
+	// SyncNever leaves flushing to the operating system.
+	SyncNever SyncMode = "never"
+)
+
+func ParseSyncMode(s string) (SyncMode, error) {
+	switch mode := SyncMode(s); mode {
+	case SyncAlways, SyncInterval, SyncNever:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown fsync policy %q, want always, interval or never", s)
+	}
+}
+
+// SyncPolicy configures when a Producer syncs. The zero value never syncs.
+type SyncPolicy struct {
+	Mode     SyncMode
+	Interval time.Duration
+}
+
+// Options configures a Producer. The zero value writes JSON and never syncs.
+type Options struct {
+	Format Format
+	Sync   SyncPolicy
 }
 
 type Producer struct {
-	file    *os.File
-	encoder *json.Encoder
+	file   *os.File
+	format Format
+	policy SyncPolicy
+
+	dirty   atomic.Bool
+	done    chan struct{}
+	stopped chan struct{}
 }
 
-var P *Producer
+// NewProducer opens fileName for appending events. A new or empty file is
+// written in opts.Format; an existing file must already be in that format.
+func NewProducer(fileName string, opts Options) (*Producer, error) {
+	format := opts.Format
+	if format == "" {
+		format = FormatJSON
+	}
 
-func NewProducer(fileName string) (*Producer, error) {
-	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	file, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Producer{
-		file:    file,
-		encoder: json.NewEncoder(file),
-	}, nil
+	existing, err := detectFormat(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	switch {
+	case existing == "" && format == FormatBinary:
+		if _, err := file.Write(binaryHeader()); err != nil {
+			file.Close()
+			return nil, err
+		}
+	case existing != "" && existing != format:
+		file.Close()
+		return nil, fmt.Errorf("%s is in %s format, convert it to %s first", fileName, existing, format)
+	}
+
+	p := &Producer{
+		file:   file,
+		format: format,
+		policy: opts.Sync,
+	}
+	if p.policy.Mode == SyncInterval && p.policy.Interval > 0 {
+		p.done = make(chan struct{})
+		p.stopped = make(chan struct{})
+		go p.syncLoop()
+	}
+	return p, nil
 }
 
 func (p *Producer) WriteEvent(event *Event) error {
-	return p.encoder.Encode(&event)
+	var b []byte
+	var err error
+	if p.format == FormatBinary {
+		b, err = encodeFrame(event)
+	} else {
+		b, err = encodeLine(event)
+	}
+	if err != nil {
+		return err
+	}
+
+	// A single write keeps the record in one piece on O_APPEND files
+	if _, err := p.file.Write(b); err != nil {
+		return err
+	}
+
+	if p.policy.Mode == SyncAlways {
+		return p.file.Sync()
+	}
+	p.dirty.Store(true)
+	return nil
+}
+
+// Sync flushes written events to stable storage.
+func (p *Producer) Sync() error {
+	p.dirty.Store(false)
+	return p.file.Sync()
 }
 
 func (p *Producer) Close() error {
+	if p.done != nil {
+		close(p.done)
+		<-p.stopped
+	}
+	if p.policy.Mode == SyncInterval && p.dirty.Load() {
+		if err := p.Sync(); err != nil {
+			p.file.Close()
+			return err
+		}
+	}
 	return p.file.Close()
 }
 
+func (p *Producer) syncLoop() {
+	defer close(p.stopped)
+
+	ticker := time.NewTicker(p.policy.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if p.dirty.Load() {
+				if err := p.Sync(); err != nil {
+					log.Printf("Error syncing event file: %v", err)
+				}
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
 type Consumer struct {
-	file    *os.File
-	decoder *json.Decoder
+	file   *os.File
+	reader *bufio.Reader
 }
 
 func NewConsumer(fileName string) (*Consumer, error) {
@@ -52,28 +224,86 @@ func NewConsumer(fileName string) (*Consumer, error) {
 	}
 
 	return &Consumer{
-		file:    file,
-		decoder: json.NewDecoder(file),
+		file:   file,
+		reader: bufio.NewReader(file),
 	}, nil
 }
 
+// ReadAllEvents reads every event in the file, whatever its format. A
+// corrupted record in the middle of the file is skipped with a warning. A
+// corrupted or incomplete final record, typically left by a crash during a
+// write, is dropped and the file is truncated to the last good record, so
+// that new events are not appended to a torn record.
 func (c *Consumer) ReadAllEvents() ([]Event, error) {
+	header, err := c.reader.Peek(len(binaryMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
 	var events []Event
+	var r repair
+	if bytes.Equal(header, []byte(binaryMagic)) {
+		events, r, err = c.readBinary()
+	} else {
+		events, r, err = c.readJSON()
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	for {
-		event := &Event{}
-		if err := c.decoder.Decode(&event); err != nil {
-			if err == io.EOF { // Достигнут конец файла
-				break
-			}
-			return nil, err // Возвращаем ошибку, если она не EOF
+	if r.needed {
+		if err := repairTail(c.file.Name(), r.size, r.addNewline); err != nil {
+			return nil, fmt.Errorf("repairing %s: %w", c.file.Name(), err)
 		}
-		events = append(events, *event)
 	}
-
 	return events, nil
 }
 
 func (c *Consumer) Close() error {
 	return c.file.Close()
 }
+
+// detectFormat returns the format of file, or "" if it is empty.
+func detectFormat(file *os.File) (Format, error) {
+	header := make([]byte, len(binaryMagic))
+	n, err := file.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	switch {
+	case n == 0:
+		return "", nil
+	case bytes.Equal(header[:n], []byte(binaryMagic)):
+		return FormatBinary, nil
+	default:
+		return FormatJSON, nil
+	}
+}
+
+// repair describes how to fix the tail of a file after reading it.
+type repair struct {
+	needed     bool
+	size       int64 // end of the last good record
+	addNewline bool  // the last JSON record lacks its newline
+}
+
+// repairTail truncates fileName to size. If the last record is valid but
+// lacks its newline, size already covers it and the newline is added.
+func repairTail(fileName string, size int64, addNewline bool) error {
+	file, err := os.OpenFile(fileName, os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if addNewline {
+		if _, err := file.WriteAt([]byte{'\n'}, size); err != nil {
+			return err
+		}
+		size++
+	}
+	if err := file.Truncate(size); err != nil {
+		return err
+	}
+	return file.Sync()
+}
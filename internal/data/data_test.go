@@ -0,0 +1,145 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeEvents(t *testing.T, fileName string, opts Options, events ...Event) {
+	p, err := NewProducer(fileName, opts)
+	require.NoError(t, err)
+	for i := range events {
+		require.NoError(t, p.WriteEvent(&events[i]))
+	}
+	require.NoError(t, p.Close())
+}
+
+func readEvents(t *testing.T, fileName string) []Event {
+	c, err := NewConsumer(fileName)
+	require.NoError(t, err)
+	defer c.Close()
+	events, err := c.ReadAllEvents()
+	require.NoError(t, err)
+	return events
+}
+
+func shorts(events []Event) []string {
+	var ids []string
+	for _, e := range events {
+		ids = append(ids, e.Short)
+	}
+	return ids
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, mode := range []SyncMode{SyncAlways, SyncInterval, SyncNever} {
+		t.Run(string(mode), func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "data.json")
+			opts := Options{Sync: SyncPolicy{Mode: mode, Interval: time.Millisecond}}
+			writeEvents(t, fileName, opts,
+				Event{Type: EventCreated, ID: 1, Short: "a", Long: "https://a", UserID: "u"},
+				Event{Type: EventDeleted, Short: "a", UserID: "u"},
+			)
+
+			events := readEvents(t, fileName)
+			require.Len(t, events, 2)
+			assert.Equal(t, "https://a", events[0].Long)
+			assert.NotZero(t, events[0].Checksum)
+			assert.Equal(t, EventDeleted, events[1].Type)
+		})
+	}
+}
+
+func TestParseSyncMode(t *testing.T) {
+	mode, err := ParseSyncMode("always")
+	require.NoError(t, err)
+	assert.Equal(t, SyncAlways, mode)
+
+	_, err = ParseSyncMode("sometimes")
+	assert.Error(t, err)
+}
+
+func TestRecovery(t *testing.T) {
+	valid := func(t *testing.T, short string) string {
+		fileName := filepath.Join(t.TempDir(), "line.json")
+		writeEvents(t, fileName, Options{}, Event{Type: EventCreated, ID: 1, Short: short, Long: "https://" + short, UserID: "u"})
+		b, err := os.ReadFile(fileName)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	tests := []struct {
+		name     string
+		content  func(t *testing.T) string
+		want     []string
+		wantFile func(t *testing.T) string
+	}{
+		{
+			name: "torn tail is truncated",
+			content: func(t *testing.T) string {
+				return valid(t, "a") + `{"type":"created","id":2,"short_u`
+			},
+			want:     []string{"a"},
+			wantFile: func(t *testing.T) string { return valid(t, "a") },
+		},
+		{
+			name: "checksum mismatch at the tail is truncated",
+			content: func(t *testing.T) string {
+				return valid(t, "a") + strings.Replace(valid(t, "b"), "https://b", "https://x", 1)
+			},
+			want:     []string{"a"},
+			wantFile: func(t *testing.T) string { return valid(t, "a") },
+		},
+		{
+			name: "corrupted record in the middle is skipped",
+			content: func(t *testing.T) string {
+				return valid(t, "a") + "garbage\n" + valid(t, "c")
+			},
+			want: []string{"a", "c"},
+			wantFile: func(t *testing.T) string {
+				return valid(t, "a") + "garbage\n" + valid(t, "c")
+			},
+		},
+		{
+			name: "missing final newline is restored",
+			content: func(t *testing.T) string {
+				return strings.TrimSuffix(valid(t, "a"), "\n")
+			},
+			want:     []string{"a"},
+			wantFile: func(t *testing.T) string { return valid(t, "a") },
+		},
+		{
+			name: "records without checksum are accepted",
+			content: func(t *testing.T) string {
+				return `{"id":1,"short_url":"legacy","original_url":"https://legacy","user_id":"u"}` + "\n"
+			},
+			want: []string{"legacy"},
+			wantFile: func(t *testing.T) string {
+				return `{"id":1,"short_url":"legacy","original_url":"https://legacy","user_id":"u"}` + "\n"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "data.json")
+			require.NoError(t, os.WriteFile(fileName, []byte(tt.content(t)), 0666))
+
+			assert.Equal(t, tt.want, shorts(readEvents(t, fileName)))
+
+			b, err := os.ReadFile(fileName)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantFile(t), string(b))
+
+			// Appending after recovery must produce a readable file
+			writeEvents(t, fileName, Options{}, Event{Type: EventCreated, ID: 9, Short: "z", Long: "https://z", UserID: "u"})
+			assert.Equal(t, append(tt.want, "z"), shorts(readEvents(t, fileName)))
+		})
+	}
+}
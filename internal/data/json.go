@@ -0,0 +1,90 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"log"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var errChecksum = errors.New("checksum mismatch")
+
+func (e Event) checksum() uint32 {
+	e.Checksum = 0
+	b, _ := json.Marshal(e)
+	return crc32.Checksum(b, crcTable)
+}
+
+// encodeLine returns event as a checksummed JSON line.
+func encodeLine(event *Event) ([]byte, error) {
+	e := *event
+	e.Checksum = e.checksum()
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func decodeLine(b []byte) (Event, error) {
+	var event Event
+	if err := json.Unmarshal(b, &event); err != nil {
+		return Event{}, err
+	}
+	if event.Checksum != 0 && event.checksum() != event.Checksum {
+		return Event{}, errChecksum
+	}
+	return event, nil
+}
+
+func (c *Consumer) readJSON() ([]Event, repair, error) {
+	var events []Event
+	var offset, good int64 // good is the end of the last valid record
+	var line, badLine int  // badLine is the last corrupted record seen
+	var badErr error
+	missingNewline := false
+
+	for {
+		b, err := c.reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, repair{}, err
+		}
+		if len(b) == 0 {
+			break // Достигнут конец файла
+		}
+		line++
+		offset += int64(len(b))
+
+		if len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+
+		event, err := decodeLine(b)
+		if badLine != 0 {
+			// A record follows, so the corrupted one is not the tail
+			log.Printf("Skipping corrupted event at %s:%d: %v", c.file.Name(), badLine, badErr)
+			badLine = 0
+		}
+		if err != nil {
+			badLine, badErr = line, err
+			continue
+		}
+		events = append(events, event)
+		good = offset
+		missingNewline = b[len(b)-1] != '\n'
+	}
+
+	if badLine != 0 {
+		log.Printf("Dropping corrupted tail of %s after byte %d: %v", c.file.Name(), good, badErr)
+	}
+	return events, repair{
+		needed:     good != offset || missingNewline,
+		size:       good,
+		addNewline: missingNewline,
+	}, nil
+}
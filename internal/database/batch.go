@@ -0,0 +1,81 @@
+package database
+
+// BatchResult представляет результат сохранения одной пары из пакета
+type BatchResult struct {
+	// ShortURL — идентификатор, под которым хранится URL: идентификатор
+	// корреляции для новой ссылки или существующий идентификатор, если URL
+	// у пользователя уже был
+	ShortURL string
+	// Conflict означает, что пара не сохранена: URL у пользователя уже есть
+	// или идентификатор занят другой ссылкой (тогда ShortURL пуст)
+	Conflict bool
+}
+
+// batchPlan разбирает пакет до обращения к базе: повторы внутри пакета не
+// сохраняются, а получают результат более ранней пары
+type batchPlan struct {
+	results []BatchResult
+	// pending — позиции пар, которые нужно проверить и вставить
+	pending []int
+	// sameURL связывает позицию пары с позицией более ранней пары с тем же
+	// URL того же пользователя
+	sameURL map[int]int
+}
+
+type urlKey struct {
+	userID  string
+	longURL string
+}
+
+func planBatch(urlPairs []RequestData) batchPlan {
+	plan := batchPlan{
+		results: make([]BatchResult, len(urlPairs)),
+		sameURL: make(map[int]int),
+	}
+	urls := make(map[urlKey]int, len(urlPairs))
+	ids := make(map[string]struct{}, len(urlPairs))
+
+	for i, pair := range urlPairs {
+		key := urlKey{pair.UserID, pair.URL}
+		if first, ok := urls[key]; ok {
+			plan.sameURL[i] = first
+			continue
+		}
+		if _, ok := ids[pair.ID]; ok {
+			plan.results[i].Conflict = true
+			continue
+		}
+		urls[key] = i
+		ids[pair.ID] = struct{}{}
+		plan.pending = append(plan.pending, i)
+	}
+	return plan
+}
+
+// resolve заполняет результаты проверенных пар: existing — позиции пар, чьи
+// URL у пользователя уже были, inserted — вставленные идентификаторы.
+// Остальные пары не вставлены, потому что их идентификатор занят
+func (p batchPlan) resolve(urlPairs []RequestData, existing map[int]bool, inserted []string) {
+	ok := make(map[string]struct{}, len(inserted))
+	for _, id := range inserted {
+		ok[id] = struct{}{}
+	}
+	for _, i := range p.pending {
+		if existing[i] {
+			continue
+		}
+		if _, found := ok[urlPairs[i].ID]; found {
+			p.results[i] = BatchResult{ShortURL: urlPairs[i].ID}
+		} else {
+			p.results[i] = BatchResult{Conflict: true}
+		}
+	}
+}
+
+// finish заполняет результаты повторов и возвращает результаты пакета
+func (p batchPlan) finish() []BatchResult {
+	for i, first := range p.sameURL {
+		p.results[i] = BatchResult{ShortURL: p.results[first].ShortURL, Conflict: true}
+	}
+	return p.results
+}
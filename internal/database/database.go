@@ -2,15 +2,29 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/vkobazev/goShortenerUrl/internal/consts"
 	"time"
 )
 
+var (
+	// ErrNotFound возвращается, если запрошенного URL нет в базе
+	ErrNotFound = errors.New("URL не найден")
+	// ErrDeleted возвращается, если короткий URL удален пользователем
+	ErrDeleted = errors.New("URL удален")
+	// ErrConflict возвращается, если URL у пользователя уже есть
+	ErrConflict = errors.New("URL уже существует")
+	// ErrIDTaken возвращается, если короткий идентификатор занят другой
+	// ссылкой
+	ErrIDTaken = errors.New("идентификатор уже занят")
+)
+
 // DB представляет пул соединений с базой данных
 type DB struct {
-	pool *pgxpool.Pool
+	pool         *pgxpool.Pool
+	queryTimeout time.Duration
 }
 
 // RequestData представляет данные запроса для вставки URL
@@ -18,18 +32,47 @@ type RequestData struct {
 	ID     string `json:"correlation_id"`
 	URL    string `json:"original_url"`
 	UserID string `json:"user_id"`
+	// Redirect — код ответа при переходе по ссылке, 0 — код по умолчанию
+	Redirect int `json:"redirect,omitempty"`
+}
+
+// Link представляет то, что нужно для перехода по короткой ссылке
+type Link struct {
+	OriginalURL string
+	// Redirect — код ответа при переходе, 0 — код по умолчанию
+	Redirect int
 }
 
-// URLResponse представляет ответ с коротким и оригинальным URL
+// URLResponse представляет ответ с коротким идентификатором и оригинальным URL
 type URLResponse struct {
 	ShortURL    string `json:"short_url"`
 	OriginalURL string `json:"original_url"`
+	// Deleted отмечает удаленные ссылки, если их попросили включить в список
+	Deleted bool `json:"is_deleted,omitempty"`
+}
+
+// DeletedURL представляет удаленную ссылку, которую еще можно восстановить
+type DeletedURL struct {
+	ShortURL    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url"`
+	DeletedAt   time.Time `json:"deleted_at"`
+}
+
+// URLRecord представляет ссылку со всеми полями, нужными для переноса
+// между хранилищами
+type URLRecord struct {
+	ShortURL    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url"`
+	UserID      string    `json:"user_id"`
+	Deleted     bool      `json:"deleted"`
+	CreatedAt   time.Time `json:"created_at"`
+	Redirect    int       `json:"redirect,omitempty"`
 }
 
 func New(connString string) (*DB, error) {
 	config, err := pgxpool.ParseConfig(connString)
 	if err != nil {
-		return nil, fmt.Errorf("не удалось разобрать строку подключения: %v", err)
+		return nil, fmt.Errorf("не удалось разобрать строку подключения: %w", err)
 	}
 
 	// Опциональная настройка параметров пула соединений
@@ -38,12 +81,26 @@ func New(connString string) (*DB, error) {
 
 	pool, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
-		return nil, fmt.Errorf("не удалось создать пул соединений: %v", err)
+		return nil, fmt.Errorf("не удалось создать пул соединений: %w", err)
 	}
 
 	return &DB{pool: pool}, nil
 }
 
+// SetQueryTimeout ограничивает время каждого обращения к базе на пути
+// запроса; 0 снимает ограничение. Экспорт и импорт не ограничиваются
+func (db *DB) SetQueryTimeout(d time.Duration) {
+	db.queryTimeout = d
+}
+
+// withTimeout добавляет к контексту запроса таймаут d, если он задан
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
 func (db *DB) Close() {
 	db.pool.Close()
 }
@@ -55,71 +112,74 @@ func (db *DB) Ping(ctx context.Context) error {
 
 	err := db.pool.Ping(ctx)
 	if err != nil {
-		return fmt.Errorf("не удалось пинговать базу данных: %v", err)
+		return fmt.Errorf("не удалось пинговать базу данных: %w", err)
 	}
 
 	return nil
 }
 
-func (db *DB) CreateTable(ctx context.Context) error {
+// InsertURL вставляет ссылку одним запросом. Если у пользователя уже есть
+// этот URL, возвращает его идентификатор и ErrConflict; если занят
+// идентификатор — ErrIDTaken. Уникальный индекс по пользователю и URL
+// не дает одновременным запросам сохранить URL дважды
+func (db *DB) InsertURL(ctx context.Context, shortURL, longURL, userID string, redirect int) (string, error) {
+	ctx, cancel := withTimeout(ctx, db.queryTimeout)
+	defer cancel()
+
 	query := `
-        CREATE TABLE IF NOT EXISTS urls (
-            id SERIAL PRIMARY KEY,
-            short_url VARCHAR(50) UNIQUE NOT NULL,
-            long_url TEXT NOT NULL,
-            user_id VARCHAR(50) NOT NULL,
-            deleted BOOLEAN DEFAULT FALSE,
-            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-        );
-        CREATE INDEX IF NOT EXISTS idx_short_url ON urls (short_url, long_url);
-        CREATE INDEX IF NOT EXISTS idx_user_id ON urls (user_id);
+        INSERT INTO urls (short_url, long_url, user_id, redirect)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT DO NOTHING
+        RETURNING short_url
     `
 
-	_, err := db.pool.Exec(ctx, query)
-	if err != nil {
-		return fmt.Errorf("ошибка при создании таблицы: %v", err)
+	err := db.pool.QueryRow(ctx, query, shortURL, longURL, userID, redirect).Scan(&shortURL)
+	if err == nil {
+		return shortURL, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("ошибка при вставке URL: %w", err)
 	}
 
-	return nil
-}
-
-func (db *DB) InsertURL(ctx context.Context, shortURL, longURL, userID string) error {
-	query := `
-        INSERT INTO urls (short_url, long_url, user_id)
-        VALUES ($1, $2, $3)
-        ON CONFLICT (short_url) DO UPDATE
-        SET long_url = EXCLUDED.long_url,
-            user_id = EXCLUDED.user_id
-    `
-
-	_, err := db.pool.Exec(ctx, query, shortURL, longURL, userID)
+	// Ничего не вставлено: URL уже есть у пользователя или занят идентификатор
+	oldID, err := db.GetShortURL(ctx, longURL, userID)
+	if errors.Is(err, ErrNotFound) {
+		return "", ErrIDTaken
+	}
 	if err != nil {
-		return fmt.Errorf("ошибка при вставке URL: %v", err)
+		return "", err
 	}
-
-	return nil
+	return oldID, ErrConflict
 }
 
 func (db *DB) GetShortURL(ctx context.Context, longURL, userID string) (string, error) {
+	ctx, cancel := withTimeout(ctx, db.queryTimeout)
+	defer cancel()
+
 	var shortURL string
 	query := `
 		SELECT short_url 
 		FROM urls 
 		WHERE long_url = $1 AND user_id = $2
+		ORDER BY duplicate, id
+		LIMIT 1
 	`
 
 	err := db.pool.QueryRow(ctx, query, longURL, userID).Scan(&shortURL)
 	if err != nil {
-		if err.Error() == "no rows in result set" {
-			return "", fmt.Errorf("длинный URL не найден для пользователя")
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("длинный URL не найден для пользователя: %w", ErrNotFound)
 		}
-		return "", fmt.Errorf("ошибка при получении короткого URL: %v", err)
+		return "", fmt.Errorf("ошибка при получении короткого URL: %w", err)
 	}
 
 	return shortURL, nil
 }
 
 func (db *DB) GetLongURL(ctx context.Context, shortURL string) (string, string, error) {
+	ctx, cancel := withTimeout(ctx, db.queryTimeout)
+	defer cancel()
+
 	var longURL, userID string
 	query := `
 		SELECT long_url, user_id 
@@ -129,85 +189,174 @@ func (db *DB) GetLongURL(ctx context.Context, shortURL string) (string, string,
 
 	err := db.pool.QueryRow(ctx, query, shortURL).Scan(&longURL, &userID)
 	if err != nil {
-		if err.Error() == "no rows in result set" {
-			return "", "", fmt.Errorf("короткий URL не найден или удален")
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", fmt.Errorf("короткий URL не найден или удален: %w", ErrNotFound)
 		}
-		return "", "", fmt.Errorf("ошибка при получении длинного URL: %v", err)
+		return "", "", fmt.Errorf("ошибка при получении длинного URL: %w", err)
 	}
 
 	return longURL, userID, nil
 }
 
-func (db *DB) LongURLExists(ctx context.Context, longURL, userID string) (bool, error) {
-	var exists bool
-	query := "SELECT EXISTS(SELECT 1 FROM urls WHERE long_url = $1 AND user_id = $2)"
+// GetLink возвращает ссылку и признак ее удаления
+func (db *DB) GetLink(ctx context.Context, shortURL string) (Link, bool, error) {
+	ctx, cancel := withTimeout(ctx, db.queryTimeout)
+	defer cancel()
+
+	query := `
+        SELECT long_url, redirect, deleted
+        FROM urls
+        WHERE short_url = $1
+    `
 
-	err := db.pool.QueryRow(ctx, query, longURL, userID).Scan(&exists)
+	var link Link
+	var deleted bool
+
+	err := db.pool.QueryRow(ctx, query, shortURL).Scan(&link.OriginalURL, &link.Redirect, &deleted)
 	if err != nil {
-		return false, fmt.Errorf("ошибка при проверке существования длинного URL: %v", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Link{}, false, ErrNotFound
+		}
+		return Link{}, false, fmt.Errorf("ошибка при получении URL: %w", err)
 	}
 
-	return exists, nil
+	return link, deleted, nil
 }
 
-func (db *DB) LongURLDeleted(ctx context.Context, shortURL string) (string, bool, error) {
+// SetRedirect меняет код перехода по неудаленной ссылке пользователя или
+// возвращает ErrNotFound
+func (db *DB) SetRedirect(ctx context.Context, userID, shortURL string, redirect int) error {
+	ctx, cancel := withTimeout(ctx, db.queryTimeout)
+	defer cancel()
+
 	query := `
-        SELECT long_url, deleted
-        FROM urls
-        WHERE short_url = $1
+        UPDATE urls
+        SET redirect = $3
+        WHERE short_url = $1 AND user_id = $2 AND NOT deleted
     `
 
-	var originalURL string
-	var deleted bool
-
-	err := db.pool.QueryRow(ctx, query, shortURL).Scan(&originalURL, &deleted)
+	result, err := db.pool.Exec(ctx, query, shortURL, userID, redirect)
 	if err != nil {
-		return "", false, fmt.Errorf("ошибка при получении URL: %v", err)
+		return fmt.Errorf("ошибка при изменении перехода: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
 	}
 
-	return originalURL, deleted, nil
+	return nil
 }
 
-func (db *DB) InsertURLs(ctx context.Context, urlPairs []RequestData) error {
+// InsertURLs сохраняет пакет пар, не перезаписывая существующие ссылки.
+// Пары копируются во временную таблицу через COPY, после чего одним запросом
+// вставляются те, чьих URL у пользователя еще нет
+func (db *DB) InsertURLs(ctx context.Context, urlPairs []RequestData) ([]BatchResult, error) {
+	ctx, cancel := withTimeout(ctx, db.queryTimeout)
+	defer cancel()
+
+	plan := planBatch(urlPairs)
+	if len(plan.pending) == 0 {
+		return plan.finish(), nil
+	}
+
 	tx, err := db.pool.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+		return nil, fmt.Errorf("ошибка при начале транзакции: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
-	query := `
-        INSERT INTO urls (short_url, long_url, user_id)
-        VALUES ($1, $2, $3)
-        ON CONFLICT (short_url) DO UPDATE
-        SET long_url = EXCLUDED.long_url,
-            user_id = EXCLUDED.user_id
-    `
+	_, err = tx.Exec(ctx, `
+		CREATE TEMP TABLE batch_urls (
+			pos INTEGER,
+			short_url TEXT,
+			long_url TEXT,
+			user_id TEXT,
+			redirect SMALLINT
+		) ON COMMIT DROP
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при создании временной таблицы: %w", err)
+	}
 
-	for _, pair := range urlPairs {
-		_, err := tx.Exec(ctx, query, pair.ID, pair.URL, pair.UserID)
-		if err != nil {
-			return fmt.Errorf("ошибка при вставке пары URL (%s, %s, %s): %v",
-				pair.ID, pair.URL, pair.UserID, err)
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"batch_urls"},
+		[]string{"pos", "short_url", "long_url", "user_id", "redirect"},
+		pgx.CopyFromSlice(len(plan.pending), func(i int) ([]any, error) {
+			pair := urlPairs[plan.pending[i]]
+			return []any{plan.pending[i], pair.ID, pair.URL, pair.UserID, int16(pair.Redirect)}, nil
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при копировании пакета URL: %w", err)
+	}
+
+	// URL, которые уже есть у пользователя, не вставляются
+	rows, err := tx.Query(ctx, `
+		SELECT DISTINCT ON (b.pos) b.pos, u.short_url
+		FROM batch_urls b
+		JOIN urls u ON u.long_url = b.long_url AND u.user_id = b.user_id
+		ORDER BY b.pos, u.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при поиске существующих URL: %w", err)
+	}
+	existing := make(map[int]bool)
+	for rows.Next() {
+		var pos int
+		var shortURL string
+		if err := rows.Scan(&pos, &shortURL); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка при чтении строки: %w", err)
 		}
+		plan.results[pos] = BatchResult{ShortURL: shortURL, Conflict: true}
+		existing[pos] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при поиске существующих URL: %w", err)
+	}
+
+	rows, err = tx.Query(ctx, `
+		INSERT INTO urls (short_url, long_url, user_id, redirect)
+		SELECT b.short_url, b.long_url, b.user_id, b.redirect
+		FROM batch_urls b
+		WHERE NOT EXISTS (
+			SELECT 1 FROM urls u
+			WHERE u.long_url = b.long_url AND u.user_id = b.user_id
+		)
+		ORDER BY b.pos
+		ON CONFLICT DO NOTHING
+		RETURNING short_url
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при вставке пакета URL: %w", err)
+	}
+	inserted, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при вставке пакета URL: %w", err)
 	}
 
 	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf("ошибка при коммите транзакции: %v", err)
+		return nil, fmt.Errorf("ошибка при коммите транзакции: %w", err)
 	}
 
-	return nil
+	plan.resolve(urlPairs, existing, inserted)
+	return plan.finish(), nil
 }
 
 func (db *DB) GetURLsByUser(ctx context.Context, userID string) ([]URLResponse, error) {
+	ctx, cancel := withTimeout(ctx, db.queryTimeout)
+	defer cancel()
+
 	query := `
-		SELECT short_url, long_url 
-		FROM urls 
+		SELECT short_url, long_url
+		FROM urls
 		WHERE user_id = $1
+		  AND NOT COALESCE(deleted, FALSE)
 	`
 
 	rows, err := db.pool.Query(ctx, query, userID)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при запросе URL: %v", err)
+		return nil, fmt.Errorf("ошибка при запросе URL: %w", err)
 	}
 	defer rows.Close()
 
@@ -216,41 +365,234 @@ func (db *DB) GetURLsByUser(ctx context.Context, userID string) ([]URLResponse,
 		var shortURL, longURL string
 		err := rows.Scan(&shortURL, &longURL)
 		if err != nil {
-			return nil, fmt.Errorf("ошибка при сканировании строки URL: %v", err)
+			return nil, fmt.Errorf("ошибка при сканировании строки URL: %w", err)
 		}
 
 		urls = append(urls, URLResponse{
-			ShortURL:    consts.BaseURL + shortURL,
+			ShortURL:    shortURL,
 			OriginalURL: longURL,
 		})
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("ошибка при итерации строк URL: %v", err)
+		return nil, fmt.Errorf("ошибка при итерации строк URL: %w", err)
 	}
 
 	return urls, nil
 }
 
 func (db *DB) DeleteURLforUser(ctx context.Context, userID string, shortURLs []string) error {
+	ctx, cancel := withTimeout(ctx, db.queryTimeout)
+	defer cancel()
+
 	if len(shortURLs) == 0 {
 		return nil
 	}
 
 	query := `
         UPDATE urls
-        SET deleted = TRUE
+        SET deleted = TRUE,
+            deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP)
         WHERE user_id = $1
           AND short_url = ANY($2::text[])
     `
 
-	result, err := db.pool.Exec(ctx, query, userID, shortURLs)
+	// Чужие и уже удаленные ссылки пропускаются без ошибки, как в памяти
+	// и в файле: повторять такое удаление бессмысленно
+	_, err := db.pool.Exec(ctx, query, userID, shortURLs)
 	if err != nil {
-		return fmt.Errorf("ошибка при пометке URL как удаленных: %v", err)
+		return fmt.Errorf("ошибка при пометке URL как удаленных: %w", err)
 	}
 
-	if result.RowsAffected() == 0 {
-		return fmt.Errorf("не было обновлено ни одного URL")
+	return nil
+}
+
+// GetDeletedURLsByUser возвращает ссылки пользователя, удаленные не раньше
+// since, начиная с последних удаленных
+func (db *DB) GetDeletedURLsByUser(ctx context.Context, userID string, since time.Time) ([]DeletedURL, error) {
+	ctx, cancel := withTimeout(ctx, db.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT short_url, long_url, deleted_at
+		FROM urls
+		WHERE user_id = $1
+		  AND deleted AND deleted_at >= $2
+		ORDER BY deleted_at DESC, id DESC
+	`
+
+	rows, err := db.pool.Query(ctx, query, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при запросе удаленных URL: %w", err)
+	}
+	defer rows.Close()
+
+	var urls []DeletedURL
+	for rows.Next() {
+		var u DeletedURL
+		if err := rows.Scan(&u.ShortURL, &u.OriginalURL, &u.DeletedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании строки URL: %w", err)
+		}
+		urls = append(urls, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации строк URL: %w", err)
+	}
+
+	return urls, nil
+}
+
+// RestoreURLs снимает пометку удаления со ссылок пользователя, удаленных не
+// раньше since, и возвращает восстановленные идентификаторы
+func (db *DB) RestoreURLs(ctx context.Context, userID string, shortURLs []string, since time.Time) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, db.queryTimeout)
+	defer cancel()
+
+	if len(shortURLs) == 0 {
+		return nil, nil
+	}
+
+	query := `
+        UPDATE urls
+        SET deleted = FALSE,
+            deleted_at = NULL
+        WHERE user_id = $1
+          AND short_url = ANY($2::text[])
+          AND deleted AND deleted_at >= $3
+        RETURNING short_url
+    `
+
+	rows, err := db.pool.Query(ctx, query, userID, shortURLs, since)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при восстановлении URL: %w", err)
+	}
+	restored, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при восстановлении URL: %w", err)
+	}
+
+	return restored, nil
+}
+
+// CountURLs возвращает число ссылок в таблице, включая удаленные
+func (db *DB) CountURLs(ctx context.Context) (int64, error) {
+	ctx, cancel := withTimeout(ctx, db.queryTimeout)
+	defer cancel()
+
+	var n int64
+	if err := db.pool.QueryRow(ctx, "SELECT COUNT(*) FROM urls").Scan(&n); err != nil {
+		return 0, fmt.Errorf("ошибка при подсчете URL: %w", err)
+	}
+	return n, nil
+}
+
+// purgeChunk — сколько строк удаляет один запрос PurgeDeleted, чтобы не
+// держать блокировки долго
+const purgeChunk = 1000
+
+// PurgeDeleted окончательно удаляет ссылки, удаленные раньше before, и
+// возвращает их число
+func (db *DB) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+        DELETE FROM urls
+        WHERE id IN (
+            SELECT id
+            FROM urls
+            WHERE deleted AND deleted_at < $1
+            LIMIT $2
+        )
+    `
+
+	var total int64
+	for {
+		result, err := db.pool.Exec(ctx, query, before, purgeChunk)
+		if err != nil {
+			return total, fmt.Errorf("ошибка при удалении URL: %w", err)
+		}
+		total += result.RowsAffected()
+		if result.RowsAffected() < purgeChunk {
+			return total, nil
+		}
+	}
+}
+
+// ExportURLs вызывает fn для каждой ссылки в таблице
+func (db *DB) ExportURLs(ctx context.Context, fn func(URLRecord) error) error {
+	query := `
+		SELECT short_url, long_url, user_id, COALESCE(deleted, FALSE), created_at, redirect
+		FROM urls
+		ORDER BY id
+	`
+
+	rows, err := db.pool.Query(ctx, query)
+	if err != nil {
+		return fmt.Errorf("ошибка при запросе URL: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r URLRecord
+		var createdAt *time.Time
+		err := rows.Scan(&r.ShortURL, &r.OriginalURL, &r.UserID, &r.Deleted, &createdAt, &r.Redirect)
+		if err != nil {
+			return fmt.Errorf("ошибка при сканировании строки URL: %w", err)
+		}
+		if createdAt != nil {
+			r.CreatedAt = *createdAt
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("ошибка при итерации строк URL: %w", err)
+	}
+
+	return nil
+}
+
+// ImportURLs сохраняет ссылки вместе с их идентификаторами, владельцами,
+// признаком удаления, временем создания и кодом перехода, перезаписывая
+// существующие.
+// Время удаления не переносится: срок хранения удаленных ссылок
+// отсчитывается заново. Ссылка на URL, который у пользователя уже есть под
+// другим идентификатором, сохраняется как копия
+func (db *DB) ImportURLs(ctx context.Context, records []URLRecord) error {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+        INSERT INTO urls (short_url, long_url, user_id, deleted, deleted_at, created_at, redirect, duplicate)
+        VALUES ($1, $2, $3, $4, CASE WHEN $4 THEN CURRENT_TIMESTAMP END, COALESCE($5, CURRENT_TIMESTAMP), $6,
+                EXISTS (SELECT 1 FROM urls WHERE user_id = $3 AND long_url = $2 AND short_url <> $1 AND NOT duplicate))
+        ON CONFLICT (short_url) DO UPDATE
+        SET long_url = EXCLUDED.long_url,
+            user_id = EXCLUDED.user_id,
+            deleted = EXCLUDED.deleted,
+            deleted_at = EXCLUDED.deleted_at,
+            created_at = EXCLUDED.created_at,
+            redirect = EXCLUDED.redirect,
+            duplicate = EXCLUDED.duplicate
+    `
+
+	for _, r := range records {
+		var createdAt *time.Time
+		if !r.CreatedAt.IsZero() {
+			createdAt = &r.CreatedAt
+		}
+		_, err := tx.Exec(ctx, query, r.ShortURL, r.OriginalURL, r.UserID, r.Deleted, createdAt, r.Redirect)
+		if err != nil {
+			return fmt.Errorf("ошибка при импорте URL %s: %w", r.ShortURL, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("ошибка при коммите транзакции: %w", err)
 	}
 
 	return nil
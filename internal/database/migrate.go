@@ -0,0 +1,202 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Миграции лежат в migrations/ парами NNNN_name.up.sql / NNNN_name.down.sql
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+var migrationName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// migrationLockID - ключ advisory lock, под которым выполняются миграции,
+// чтобы несколько экземпляров сервиса не мигрировали базу одновременно
+const migrationLockID = 0x73686f7274 // "short"
+
+// Migration представляет одну версию схемы
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// Migrations возвращает встроенные миграции, упорядоченные по версии
+func Migrations() ([]Migration, error) {
+	return loadMigrations(migrationsFS)
+}
+
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		base := file[len("migrations/"):]
+		m := migrationName.FindStringSubmatch(base)
+		if m == nil {
+			return nil, fmt.Errorf("некорректное имя файла миграции: %s", base)
+		}
+		version, _ := strconv.Atoi(m[1])
+
+		body, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("разные имена у миграции %d: %s и %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.up = string(body)
+		} else {
+			mig.down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.up == "" || mig.down == "" {
+			return nil, fmt.Errorf("у миграции %d нет пары up/down", mig.Version)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// SchemaVersion возвращает версию последней применённой миграции
+func (db *DB) SchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := db.withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		var err error
+		version, err = schemaVersion(ctx, conn)
+		return err
+	})
+	return version, err
+}
+
+// MigrateUp применяет все ещё не применённые миграции
+func (db *DB) MigrateUp(ctx context.Context) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	return db.withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		current, err := schemaVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range migrations {
+			if mig.Version <= current {
+				continue
+			}
+			err := applyMigration(ctx, conn, mig.up,
+				"INSERT INTO schema_version (version) VALUES ($1)", mig.Version)
+			if err != nil {
+				return fmt.Errorf("ошибка при применении миграции %d_%s: %w", mig.Version, mig.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateDown откатывает steps последних применённых миграций
+func (db *DB) MigrateDown(ctx context.Context, steps int) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	return db.withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		current, err := schemaVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			mig := migrations[i]
+			if mig.Version > current {
+				continue
+			}
+			err := applyMigration(ctx, conn, mig.down,
+				"DELETE FROM schema_version WHERE version = $1", mig.Version)
+			if err != nil {
+				return fmt.Errorf("ошибка при откате миграции %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// withMigrationLock выполняет fn на отдельном соединении под advisory lock
+func (db *DB) withMigrationLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("не удалось получить соединение: %v", err)
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID)
+	if err != nil {
+		return fmt.Errorf("не удалось получить блокировку миграций: %v", err)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	_, err = conn.Exec(ctx, `
+        CREATE TABLE IF NOT EXISTS schema_version (
+            version INTEGER PRIMARY KEY,
+            applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+        )
+    `)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании таблицы schema_version: %v", err)
+	}
+
+	return fn(conn)
+}
+
+func schemaVersion(ctx context.Context, conn *pgxpool.Conn) (int, error) {
+	var version int
+	err := conn.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при получении версии схемы: %v", err)
+	}
+	return version, nil
+}
+
+// applyMigration выполняет скрипт миграции и обновление schema_version
+// в одной транзакции
+func applyMigration(ctx context.Context, conn *pgxpool.Conn, script, versionQuery string, version int) error {
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, script); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, versionQuery, version)
+		return err
+	})
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, mig := range migrations {
+		assert.Equal(t, i+1, mig.Version, "versions must be contiguous")
+		assert.NotEmpty(t, mig.up)
+		assert.NotEmpty(t, mig.down)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_b.up.sql":   {Data: []byte("up 2")},
+		"migrations/0002_b.down.sql": {Data: []byte("down 2")},
+		"migrations/0001_a.up.sql":   {Data: []byte("up 1")},
+		"migrations/0001_a.down.sql": {Data: []byte("down 1")},
+	}
+	migrations, err := loadMigrations(fsys)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, Migration{Version: 1, Name: "a", up: "up 1", down: "down 1"}, migrations[0])
+	assert.Equal(t, Migration{Version: 2, Name: "b", up: "up 2", down: "down 2"}, migrations[1])
+
+	// Missing down script
+	delete(fsys, "migrations/0002_b.down.sql")
+	_, err = loadMigrations(fsys)
+	assert.Error(t, err)
+
+	// Bad file name
+	fsys["migrations/bad.sql"] = &fstest.MapFile{Data: []byte("x")}
+	_, err = loadMigrations(fsys)
+	assert.Error(t, err)
+}
+
+// TestMigrateUpDown needs TEST_DATABASE_DSN, see `make test_db`.
+func TestMigrateUpDown(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	ctx := context.Background()
+
+	db, err := New(dsn)
+	require.NoError(t, err)
+	defer db.Close()
+
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	latest := migrations[len(migrations)-1].Version
+
+	require.NoError(t, db.MigrateUp(ctx))
+	version, err := db.SchemaVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, latest, version)
+
+	// Re-running is a no-op
+	require.NoError(t, db.MigrateUp(ctx))
+
+	require.NoError(t, db.MigrateDown(ctx, 1))
+	version, err = db.SchemaVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, latest-1, version)
+
+	require.NoError(t, db.MigrateUp(ctx))
+	version, err = db.SchemaVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, latest, version)
+}
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS urls (
+    id SERIAL PRIMARY KEY,
+    short_url VARCHAR(50) UNIQUE NOT NULL,
+    long_url TEXT NOT NULL,
+    user_id VARCHAR(50) NOT NULL,
+    deleted BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_short_url ON urls (short_url, long_url);
+CREATE INDEX IF NOT EXISTS idx_user_id ON urls (user_id);
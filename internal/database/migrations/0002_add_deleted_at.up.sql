@@ -0,0 +1,3 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+UPDATE urls SET deleted_at = CURRENT_TIMESTAMP WHERE deleted AND deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_deleted_at ON urls (deleted_at) WHERE deleted;
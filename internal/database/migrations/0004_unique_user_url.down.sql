@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_user_long_url;
+ALTER TABLE urls DROP COLUMN IF EXISTS duplicate;
@@ -0,0 +1,6 @@
+-- Копии, которые раньше создавали одновременные запросы, остаются доступными,
+-- но не участвуют в проверке уникальности
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS duplicate BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE urls u SET duplicate = TRUE
+WHERE EXISTS (SELECT 1 FROM urls o WHERE o.user_id = u.user_id AND o.long_url = u.long_url AND o.id < u.id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_long_url ON urls (user_id, long_url) WHERE NOT duplicate;
@@ -0,0 +1,685 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLite представляет встроенную базу данных SQLite с той же схемой, что и DB
+type SQLite struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+func NewSQLite(path string) (*SQLite, error) {
+	// WAL не мешает читать базу другим процессам, а busy_timeout заставляет
+	// ждать их блокировку записи вместо немедленной ошибки SQLITE_BUSY
+	dsn := "file:" + path +
+		"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_txlock=immediate"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть базу данных SQLite: %w", err)
+	}
+	// SQLite допускает одного писателя, а busy_timeout не спасает от
+	// взаимной блокировки транзакций, начатых на разных соединениях.
+	// Одно соединение выстраивает все обращения в очередь пула
+	db.SetMaxOpenConns(1)
+
+	return &SQLite{db: db}, nil
+}
+
+// SetQueryTimeout ограничивает время каждого обращения к базе на пути
+// запроса; 0 снимает ограничение
+func (s *SQLite) SetQueryTimeout(d time.Duration) {
+	s.queryTimeout = d
+}
+
+func (s *SQLite) Close() {
+	s.db.Close()
+}
+
+func (s *SQLite) Ping(ctx context.Context) error {
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err := s.db.PingContext(ctx)
+	if err != nil {
+		return fmt.Errorf("не удалось пинговать базу данных: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLite) CreateTable(ctx context.Context) error {
+	query := `
+        CREATE TABLE IF NOT EXISTS urls (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            short_url VARCHAR(50) UNIQUE NOT NULL,
+            long_url TEXT NOT NULL,
+            user_id VARCHAR(50) NOT NULL,
+            deleted BOOLEAN NOT NULL DEFAULT FALSE,
+            deleted_at TIMESTAMP,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            redirect INTEGER NOT NULL DEFAULT 0
+        );
+        CREATE INDEX IF NOT EXISTS idx_short_url ON urls (short_url, long_url);
+        CREATE INDEX IF NOT EXISTS idx_user_id ON urls (user_id);
+    `
+
+	_, err := s.db.ExecContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании таблицы: %w", err)
+	}
+
+	// Таблицы, созданные до появления deleted_at и redirect, получают
+	// колонки здесь
+	hasDeletedAt, err := s.hasColumn(ctx, "deleted_at")
+	if err != nil {
+		return err
+	}
+	if !hasDeletedAt {
+		query := `
+            ALTER TABLE urls ADD COLUMN deleted_at TIMESTAMP;
+            UPDATE urls SET deleted_at = CURRENT_TIMESTAMP WHERE deleted;
+        `
+		if _, err := s.db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("ошибка при добавлении колонки deleted_at: %w", err)
+		}
+	}
+
+	hasRedirect, err := s.hasColumn(ctx, "redirect")
+	if err != nil {
+		return err
+	}
+	if !hasRedirect {
+		_, err := s.db.ExecContext(ctx, `ALTER TABLE urls ADD COLUMN redirect INTEGER NOT NULL DEFAULT 0`)
+		if err != nil {
+			return fmt.Errorf("ошибка при добавлении колонки redirect: %w", err)
+		}
+	}
+
+	_, err = s.db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_deleted_at ON urls (deleted_at) WHERE deleted`)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании индекса: %w", err)
+	}
+
+	return nil
+}
+
+// hasColumn проверяет, есть ли в таблице urls колонка name
+func (s *SQLite) hasColumn(ctx context.Context, name string) (bool, error) {
+	var ok bool
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) > 0 FROM pragma_table_info('urls') WHERE name = ?`, name,
+	).Scan(&ok)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при проверке схемы: %w", err)
+	}
+	return ok, nil
+}
+
+// InsertURL вставляет ссылку одним запросом. Если у пользователя уже есть
+// этот URL, возвращает его идентификатор и ErrConflict; если занят
+// идентификатор — ErrIDTaken. Запрос с записью в SQLite выполняется
+// целиком под блокировкой записи, поэтому проверка и вставка атомарны
+func (s *SQLite) InsertURL(ctx context.Context, shortURL, longURL, userID string, redirect int) (string, error) {
+	ctx, cancel := withTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	query := `
+        INSERT INTO urls (short_url, long_url, user_id, redirect)
+        SELECT ?1, ?2, ?3, ?4
+        WHERE NOT EXISTS (SELECT 1 FROM urls WHERE long_url = ?2 AND user_id = ?3)
+        ON CONFLICT (short_url) DO NOTHING
+    `
+
+	result, err := s.db.ExecContext(ctx, query, shortURL, longURL, userID, redirect)
+	if err != nil {
+		return "", fmt.Errorf("ошибка при вставке URL: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("ошибка при вставке URL: %w", err)
+	}
+	if affected > 0 {
+		return shortURL, nil
+	}
+
+	// Ничего не вставлено: URL уже есть у пользователя или занят идентификатор
+	oldID, err := s.GetShortURL(ctx, longURL, userID)
+	if errors.Is(err, ErrNotFound) {
+		return "", ErrIDTaken
+	}
+	if err != nil {
+		return "", err
+	}
+	return oldID, ErrConflict
+}
+
+func (s *SQLite) GetShortURL(ctx context.Context, longURL, userID string) (string, error) {
+	ctx, cancel := withTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	var shortURL string
+	query := `
+		SELECT short_url
+		FROM urls
+		WHERE long_url = ? AND user_id = ?
+	`
+
+	err := s.db.QueryRowContext(ctx, query, longURL, userID).Scan(&shortURL)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("длинный URL не найден для пользователя: %w", ErrNotFound)
+		}
+		return "", fmt.Errorf("ошибка при получении короткого URL: %w", err)
+	}
+
+	return shortURL, nil
+}
+
+func (s *SQLite) GetLongURL(ctx context.Context, shortURL string) (string, string, error) {
+	ctx, cancel := withTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	var longURL, userID string
+	query := `
+		SELECT long_url, user_id
+		FROM urls
+		WHERE short_url = ? AND deleted = FALSE
+	`
+
+	err := s.db.QueryRowContext(ctx, query, shortURL).Scan(&longURL, &userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", "", fmt.Errorf("короткий URL не найден или удален: %w", ErrNotFound)
+		}
+		return "", "", fmt.Errorf("ошибка при получении длинного URL: %w", err)
+	}
+
+	return longURL, userID, nil
+}
+
+// GetLink возвращает ссылку и признак ее удаления
+func (s *SQLite) GetLink(ctx context.Context, shortURL string) (Link, bool, error) {
+	ctx, cancel := withTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	query := `
+        SELECT long_url, redirect, deleted
+        FROM urls
+        WHERE short_url = ?
+    `
+
+	var link Link
+	var deleted bool
+
+	err := s.db.QueryRowContext(ctx, query, shortURL).Scan(&link.OriginalURL, &link.Redirect, &deleted)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Link{}, false, ErrNotFound
+		}
+		return Link{}, false, fmt.Errorf("ошибка при получении URL: %w", err)
+	}
+
+	return link, deleted, nil
+}
+
+// SetRedirect меняет код перехода по неудаленной ссылке пользователя или
+// возвращает ErrNotFound
+func (s *SQLite) SetRedirect(ctx context.Context, userID, shortURL string, redirect int) error {
+	ctx, cancel := withTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	query := `
+        UPDATE urls
+        SET redirect = ?
+        WHERE short_url = ? AND user_id = ? AND NOT deleted
+    `
+
+	result, err := s.db.ExecContext(ctx, query, redirect, shortURL, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при изменении перехода: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при изменении перехода: %w", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// sqliteBatchChunk ограничивает число пар в одном запросе, чтобы не
+// превысить лимит параметров SQLite
+const sqliteBatchChunk = 300
+
+// sqliteIDChunk ограничивает число идентификаторов в одном IN (...)
+const sqliteIDChunk = 500
+
+// InsertURLs сохраняет пакет пар, не перезаписывая существующие ссылки.
+// Пары проверяются и вставляются многострочными запросами по
+// sqliteBatchChunk штук
+func (s *SQLite) InsertURLs(ctx context.Context, urlPairs []RequestData) ([]BatchResult, error) {
+	ctx, cancel := withTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	plan := planBatch(urlPairs)
+	if len(plan.pending) == 0 {
+		return plan.finish(), nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	existing := make(map[int]bool)
+	var inserted []string
+	for start := 0; start < len(plan.pending); start += sqliteBatchChunk {
+		chunk := plan.pending[start:min(start+sqliteBatchChunk, len(plan.pending))]
+
+		found, err := s.existingURLs(ctx, tx, urlPairs, chunk)
+		if err != nil {
+			return nil, err
+		}
+
+		var values []string
+		var args []any
+		for _, i := range chunk {
+			pair := urlPairs[i]
+			if shortURL, ok := found[urlKey{pair.UserID, pair.URL}]; ok {
+				plan.results[i] = BatchResult{ShortURL: shortURL, Conflict: true}
+				existing[i] = true
+				continue
+			}
+			values = append(values, "(?, ?, ?, ?)")
+			args = append(args, pair.ID, pair.URL, pair.UserID, pair.Redirect)
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		query := `
+			INSERT INTO urls (short_url, long_url, user_id, redirect)
+			VALUES ` + strings.Join(values, ", ") + `
+			ON CONFLICT (short_url) DO NOTHING
+			RETURNING short_url
+		`
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при вставке пакета URL: %w", err)
+		}
+		for rows.Next() {
+			var shortURL string
+			if err := rows.Scan(&shortURL); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("ошибка при чтении строки: %w", err)
+			}
+			inserted = append(inserted, shortURL)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("ошибка при вставке пакета URL: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка при коммите транзакции: %w", err)
+	}
+
+	plan.resolve(urlPairs, existing, inserted)
+	return plan.finish(), nil
+}
+
+// existingURLs возвращает идентификаторы URL из chunk, которые уже есть у
+// своих пользователей
+func (s *SQLite) existingURLs(ctx context.Context, tx *sql.Tx, urlPairs []RequestData, chunk []int) (map[urlKey]string, error) {
+	values := make([]string, len(chunk))
+	args := make([]any, 0, 2*len(chunk))
+	for n, i := range chunk {
+		values[n] = "(?, ?)"
+		args = append(args, urlPairs[i].URL, urlPairs[i].UserID)
+	}
+
+	query := `
+		SELECT long_url, user_id, short_url
+		FROM urls
+		WHERE (long_url, user_id) IN (VALUES ` + strings.Join(values, ", ") + `)
+		ORDER BY id DESC
+	`
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при поиске существующих URL: %w", err)
+	}
+	defer rows.Close()
+
+	found := make(map[urlKey]string)
+	for rows.Next() {
+		var key urlKey
+		var shortURL string
+		if err := rows.Scan(&key.longURL, &key.userID, &shortURL); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении строки: %w", err)
+		}
+		// Строки идут от новых к старым, остается самая ранняя ссылка
+		found[key] = shortURL
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при поиске существующих URL: %w", err)
+	}
+	return found, nil
+}
+
+func (s *SQLite) GetURLsByUser(ctx context.Context, userID string) ([]URLResponse, error) {
+	ctx, cancel := withTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT short_url, long_url
+		FROM urls
+		WHERE user_id = ?
+		  AND NOT deleted
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при запросе URL: %w", err)
+	}
+	defer rows.Close()
+
+	var urls []URLResponse
+	for rows.Next() {
+		var shortURL, longURL string
+		err := rows.Scan(&shortURL, &longURL)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании строки URL: %w", err)
+		}
+
+		urls = append(urls, URLResponse{
+			ShortURL:    shortURL,
+			OriginalURL: longURL,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации строк URL: %w", err)
+	}
+
+	return urls, nil
+}
+
+func (s *SQLite) DeleteURLforUser(ctx context.Context, userID string, shortURLs []string) error {
+	ctx, cancel := withTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	if len(shortURLs) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	// В SQLite нет массивов, поэтому раскрываем список в IN (?, ?, ...)
+	// частями, чтобы не превысить лимит параметров
+	for start := 0; start < len(shortURLs); start += sqliteIDChunk {
+		chunk := shortURLs[start:min(start+sqliteIDChunk, len(shortURLs))]
+		args := make([]any, 0, len(chunk)+1)
+		args = append(args, userID)
+		for _, shortURL := range chunk {
+			args = append(args, shortURL)
+		}
+
+		query := `
+            UPDATE urls
+            SET deleted = TRUE,
+                deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP)
+            WHERE user_id = ?
+              AND short_url IN (?` + strings.Repeat(", ?", len(chunk)-1) + `)
+        `
+
+		// Чужие и уже удаленные ссылки пропускаются без ошибки
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("ошибка при пометке URL как удаленных: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при коммите транзакции: %w", err)
+	}
+
+	return nil
+}
+
+// GetDeletedURLsByUser возвращает ссылки пользователя, удаленные не раньше
+// since, начиная с последних удаленных
+func (s *SQLite) GetDeletedURLsByUser(ctx context.Context, userID string, since time.Time) ([]DeletedURL, error) {
+	ctx, cancel := withTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT short_url, long_url, deleted_at
+		FROM urls
+		WHERE user_id = ?
+		  AND deleted AND deleted_at >= ?
+		ORDER BY deleted_at DESC, id DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID, since.UTC().Format(sqliteTime))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при запросе удаленных URL: %w", err)
+	}
+	defer rows.Close()
+
+	var urls []DeletedURL
+	for rows.Next() {
+		var u DeletedURL
+		var deletedAt sql.NullTime
+		if err := rows.Scan(&u.ShortURL, &u.OriginalURL, &deletedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании строки URL: %w", err)
+		}
+		u.DeletedAt = deletedAt.Time
+		urls = append(urls, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации строк URL: %w", err)
+	}
+
+	return urls, nil
+}
+
+// RestoreURLs снимает пометку удаления со ссылок пользователя, удаленных не
+// раньше since, и возвращает восстановленные идентификаторы
+func (s *SQLite) RestoreURLs(ctx context.Context, userID string, shortURLs []string, since time.Time) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	if len(shortURLs) == 0 {
+		return nil, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	var restored []string
+	for start := 0; start < len(shortURLs); start += sqliteIDChunk {
+		chunk := shortURLs[start:min(start+sqliteIDChunk, len(shortURLs))]
+		args := make([]any, 0, len(chunk)+2)
+		args = append(args, userID, since.UTC().Format(sqliteTime))
+		for _, shortURL := range chunk {
+			args = append(args, shortURL)
+		}
+
+		query := `
+            UPDATE urls
+            SET deleted = FALSE,
+                deleted_at = NULL
+            WHERE user_id = ?
+              AND deleted AND deleted_at >= ?
+              AND short_url IN (?` + strings.Repeat(", ?", len(chunk)-1) + `)
+            RETURNING short_url
+        `
+
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при восстановлении URL: %w", err)
+		}
+		for rows.Next() {
+			var shortURL string
+			if err := rows.Scan(&shortURL); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("ошибка при восстановлении URL: %w", err)
+			}
+			restored = append(restored, shortURL)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("ошибка при восстановлении URL: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка при коммите транзакции: %w", err)
+	}
+
+	return restored, nil
+}
+
+// CountURLs возвращает число ссылок в таблице, включая удаленные
+func (s *SQLite) CountURLs(ctx context.Context) (int64, error) {
+	ctx, cancel := withTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	var n int64
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM urls").Scan(&n); err != nil {
+		return 0, fmt.Errorf("ошибка при подсчете URL: %w", err)
+	}
+	return n, nil
+}
+
+// sqliteTime — формат CURRENT_TIMESTAMP, в котором хранится deleted_at;
+// сравнение строк в нем совпадает со сравнением времени
+const sqliteTime = "2006-01-02 15:04:05"
+
+// PurgeDeleted окончательно удаляет ссылки, удаленные раньше before, и
+// возвращает их число
+func (s *SQLite) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+        DELETE FROM urls
+        WHERE id IN (
+            SELECT id
+            FROM urls
+            WHERE deleted AND deleted_at < ?
+            LIMIT ?
+        )
+    `
+
+	var total int64
+	for {
+		result, err := s.db.ExecContext(ctx, query, before.UTC().Format(sqliteTime), purgeChunk)
+		if err != nil {
+			return total, fmt.Errorf("ошибка при удалении URL: %w", err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, fmt.Errorf("ошибка при удалении URL: %w", err)
+		}
+		total += n
+		if n < purgeChunk {
+			return total, nil
+		}
+	}
+}
+
+// ExportURLs вызывает fn для каждой ссылки в таблице
+func (s *SQLite) ExportURLs(ctx context.Context, fn func(URLRecord) error) error {
+	query := `
+		SELECT short_url, long_url, user_id, deleted, created_at, redirect
+		FROM urls
+		ORDER BY id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("ошибка при запросе URL: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r URLRecord
+		var createdAt sql.NullTime
+		err := rows.Scan(&r.ShortURL, &r.OriginalURL, &r.UserID, &r.Deleted, &createdAt, &r.Redirect)
+		if err != nil {
+			return fmt.Errorf("ошибка при сканировании строки URL: %w", err)
+		}
+		r.CreatedAt = createdAt.Time
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("ошибка при итерации строк URL: %w", err)
+	}
+
+	return nil
+}
+
+// ImportURLs сохраняет ссылки вместе с их идентификаторами, владельцами,
+// признаком удаления, временем создания и кодом перехода, перезаписывая
+// существующие.
+// Время удаления не переносится: срок хранения удаленных ссылок
+// отсчитывается заново
+func (s *SQLite) ImportURLs(ctx context.Context, records []URLRecord) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO urls (short_url, long_url, user_id, deleted, deleted_at, created_at, redirect)
+        VALUES (?1, ?2, ?3, ?4, CASE WHEN ?4 THEN CURRENT_TIMESTAMP END, COALESCE(?5, CURRENT_TIMESTAMP), ?6)
+        ON CONFLICT (short_url) DO UPDATE
+        SET long_url = excluded.long_url,
+            user_id = excluded.user_id,
+            deleted = excluded.deleted,
+            deleted_at = excluded.deleted_at,
+            created_at = excluded.created_at,
+            redirect = excluded.redirect
+    `
+
+	for _, r := range records {
+		var createdAt any
+		if !r.CreatedAt.IsZero() {
+			createdAt = r.CreatedAt.UTC()
+		}
+		_, err := tx.ExecContext(ctx, query, r.ShortURL, r.OriginalURL, r.UserID, r.Deleted, createdAt, r.Redirect)
+		if err != nil {
+			return fmt.Errorf("ошибка при импорте URL %s: %w", r.ShortURL, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при коммите транзакции: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openSQLite(t *testing.T) *SQLite {
+	s, err := NewSQLite(filepath.Join(t.TempDir(), "urls.db"))
+	require.NoError(t, err)
+	t.Cleanup(s.Close)
+	require.NoError(t, s.CreateTable(context.Background()))
+	return s
+}
+
+func TestSQLiteCancellation(t *testing.T) {
+	s := openSQLite(t)
+	_, err := s.InsertURL(context.Background(), "abc", "https://example.com", "u1", 0)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err = s.GetLink(ctx, "abc")
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = s.InsertURLs(ctx, []RequestData{{ID: "def", URL: "https://example.org", UserID: "u1"}})
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = s.GetURLsByUser(ctx, "u1")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSQLiteQueryTimeout(t *testing.T) {
+	s := openSQLite(t)
+	_, err := s.InsertURL(context.Background(), "abc", "https://example.com", "u1", 0)
+	require.NoError(t, err)
+
+	s.SetQueryTimeout(time.Nanosecond)
+	_, _, err = s.GetLink(context.Background(), "abc")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	err = s.DeleteURLforUser(context.Background(), "u1", []string{"abc"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	s.SetQueryTimeout(0)
+	link, deleted, err := s.GetLink(context.Background(), "abc")
+	require.NoError(t, err)
+	assert.False(t, deleted)
+	assert.Equal(t, "https://example.com", link.OriginalURL)
+}
+
+func TestSQLiteAddsDeletedAt(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewSQLite(filepath.Join(t.TempDir(), "urls.db"))
+	require.NoError(t, err)
+	t.Cleanup(s.Close)
+
+	// Таблица в том виде, в каком ее создавали до появления deleted_at
+	_, err = s.db.ExecContext(ctx, `
+        CREATE TABLE urls (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            short_url VARCHAR(50) UNIQUE NOT NULL,
+            long_url TEXT NOT NULL,
+            user_id VARCHAR(50) NOT NULL,
+            deleted BOOLEAN NOT NULL DEFAULT FALSE,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        );
+        INSERT INTO urls (short_url, long_url, user_id, deleted) VALUES ('old', 'https://old.example', 'u1', TRUE);
+    `)
+	require.NoError(t, err)
+
+	require.NoError(t, s.CreateTable(ctx))
+	require.NoError(t, s.CreateTable(ctx))
+
+	// Удаленные ранее ссылки хранятся срок целиком, начиная с обновления схемы
+	n, err := s.PurgeDeleted(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	n, err = s.PurgeDeleted(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestSQLiteManyIDs(t *testing.T) {
+	ctx := context.Background()
+	s := openSQLite(t)
+	_, err := s.InsertURL(ctx, "abc", "https://example.com", "u1", 0)
+	require.NoError(t, err)
+
+	// Список длиннее лимита параметров SQLite
+	ids := make([]string, 40000)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("id%d", i)
+	}
+	ids[len(ids)-1] = "abc"
+
+	require.NoError(t, s.DeleteURLforUser(ctx, "u1", ids))
+	_, deleted, err := s.GetLink(ctx, "abc")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	restored, err := s.RestoreURLs(ctx, "u1", ids, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"abc"}, restored)
+}
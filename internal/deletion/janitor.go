@@ -0,0 +1,87 @@
+package deletion
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Purger is the part of storage.Storage the janitor needs.
+type Purger interface {
+	Purge(ctx context.Context, before time.Time) (int, error)
+}
+
+// Janitor removes deleted links for good once they have stayed deleted for
+// longer than the retention period.
+type Janitor struct {
+	store     Purger
+	retention time.Duration
+	interval  time.Duration
+	logger    *zap.Logger
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// NewJanitor starts purging store right away and then every interval. A nil
+// Janitor, as returned for a non-positive retention, purges nothing.
+func NewJanitor(store Purger, retention, interval time.Duration, logger *zap.Logger) *Janitor {
+	if retention <= 0 {
+		return nil
+	}
+
+	j := &Janitor{
+		store:     store,
+		retention: retention,
+		interval:  interval,
+		logger:    logger,
+		stopped:   make(chan struct{}),
+	}
+	j.ctx, j.cancel = context.WithCancel(context.Background())
+	go j.run()
+	return j
+}
+
+// Close stops the janitor, cancelling a purge in progress.
+func (j *Janitor) Close() {
+	if j == nil {
+		return
+	}
+	j.cancel()
+	<-j.stopped
+}
+
+func (j *Janitor) run() {
+	defer close(j.stopped)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.purge()
+		select {
+		case <-ticker.C:
+		case <-j.ctx.Done():
+			return
+		}
+	}
+}
+
+func (j *Janitor) purge() {
+	before := time.Now().Add(-j.retention)
+	n, err := j.store.Purge(j.ctx, before)
+	if err != nil {
+		if j.ctx.Err() == nil {
+			j.logger.Error("Failed to purge deleted URLs", zap.Error(err))
+		}
+		return
+	}
+	if n > 0 {
+		j.logger.Info("Purged deleted URLs",
+			zap.Int("count", n),
+			zap.Time("deleted_before", before),
+		)
+	}
+}
@@ -0,0 +1,53 @@
+package deletion_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/vkobazev/goShortenerUrl/internal/deletion"
+)
+
+// recordingPurger remembers the cutoff of every Purge call.
+type recordingPurger struct {
+	mu     sync.Mutex
+	cutoff []time.Time
+}
+
+func (p *recordingPurger) Purge(ctx context.Context, before time.Time) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cutoff = append(p.cutoff, before)
+	return 1, nil
+}
+
+func (p *recordingPurger) Calls() []time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]time.Time(nil), p.cutoff...)
+}
+
+func TestJanitor(t *testing.T) {
+	p := &recordingPurger{}
+	j := deletion.NewJanitor(p, time.Hour, 10*time.Millisecond, zap.NewNop())
+	require.NotNil(t, j)
+
+	require.Eventually(t, func() bool { return len(p.Calls()) >= 2 }, time.Second, 5*time.Millisecond)
+	j.Close()
+
+	calls := p.Calls()
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), calls[0], time.Second)
+	// Nothing runs once closed
+	time.Sleep(30 * time.Millisecond)
+	assert.Len(t, p.Calls(), len(calls))
+
+	// Without retention deleted links are kept forever
+	j = deletion.NewJanitor(p, 0, time.Millisecond, zap.NewNop())
+	assert.Nil(t, j)
+	j.Close()
+}
@@ -0,0 +1,147 @@
+package deletion
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// record is one line of the journal. An enqueue record holds the short IDs
+// of a job that is not finished yet; a finish record holds a finished job
+// without them.
+type record struct {
+	Op        string    `json:"op"`
+	JobID     string    `json:"job_id"`
+	UserID    string    `json:"user_id"`
+	ShortURLs []string  `json:"short_urls,omitempty"`
+	Total     int       `json:"total"`
+	Processed int       `json:"processed,omitempty"`
+	Failed    int       `json:"failed,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Time      time.Time `json:"time"`
+}
+
+const (
+	opEnqueue = "enqueue"
+	opFinish  = "finish"
+)
+
+// journal appends queue changes to a file and syncs each one, so that an
+// accepted deletion is never lost. A nil journal keeps nothing.
+type journal struct {
+	mu     sync.Mutex
+	file   *os.File
+	closed bool
+}
+
+// readJournal returns the records of fileName. A line that cannot be
+// decoded, typically torn by a crash, is skipped with a warning.
+func readJournal(fileName string) ([]record, error) {
+	file, err := os.Open(fileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			log.Printf("Skipping corrupted deletion journal record %s:%d: %v", fileName, line, err)
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// openJournal replaces fileName with records and opens it for appending.
+func openJournal(fileName string, records []record) (*journal, error) {
+	tmpName := fileName + ".tmp"
+	tmp, err := os.Create(tmpName)
+	if err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for i := range records {
+		if err := enc.Encode(&records[i]); err != nil {
+			tmp.Close()
+			return nil, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpName, fileName); err != nil {
+		return nil, err
+	}
+	if dir, err := os.Open(filepath.Dir(fileName)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &journal{file: file}, nil
+}
+
+func (j *journal) append(r record) error {
+	if j == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return ErrClosed
+	}
+	if _, err := j.file.Write(b); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+func (j *journal) close() error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return nil
+	}
+	j.closed = true
+	return j.file.Close()
+}
@@ -0,0 +1,507 @@
+// Package deletion deletes links in the background. Requests of all users
+// go into one queue, are merged into batches and retried on failure. The
+// queue is journaled to a file, so accepted deletions survive a restart.
+// A Janitor removes deleted links for good after a retention period.
+package deletion
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/vkobazev/goShortenerUrl/internal/semaphore"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrClosed is returned by Enqueue once Close was called.
+	ErrClosed = errors.New("deletion queue is closed")
+	// ErrNotFound is returned by Job for unknown, expired or foreign jobs.
+	ErrNotFound = errors.New("deletion job not found")
+)
+
+// Status is the state of a deletion job.
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusDone    Status = "done"
+	// StatusFailed means some links could not be deleted after all retries.
+	StatusFailed Status = "failed"
+)
+
+// Job reports the progress of one deletion request.
+type Job struct {
+	ID        string    `json:"job_id"`
+	Status    Status    `json:"status"`
+	Total     int       `json:"total"`
+	Processed int       `json:"processed"`
+	Failed    int       `json:"failed"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	userID     string
+	finishedAt time.Time
+}
+
+// Deleter is the part of storage.Storage the queue needs.
+type Deleter interface {
+	DeleteURLs(ctx context.Context, userID string, ids []string) error
+}
+
+// Options tunes a Queue. Zero fields take the defaults below.
+type Options struct {
+	// BatchSize is the most short IDs deleted in one round, 500 by default.
+	BatchSize int
+	// FlushInterval is how long a partial batch waits for more IDs,
+	// 100ms by default.
+	FlushInterval time.Duration
+	// Workers is how many storage calls run at once, 4 by default.
+	Workers int
+	// MaxAttempts is how many times a failed call is tried, 5 by default.
+	MaxAttempts int
+	// RetryDelay is the wait before the first retry, doubled on every
+	// following one, 100ms by default.
+	RetryDelay time.Duration
+	// Retention is how long finished jobs can be polled, 1h by default.
+	Retention time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.BatchSize <= 0 {
+		o.BatchSize = 500
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = 100 * time.Millisecond
+	}
+	if o.Workers <= 0 {
+		o.Workers = 4
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 5
+	}
+	if o.RetryDelay <= 0 {
+		o.RetryDelay = 100 * time.Millisecond
+	}
+	if o.Retention <= 0 {
+		o.Retention = time.Hour
+	}
+	return o
+}
+
+type item struct {
+	jobID     string
+	userID    string
+	shortURL  string
+	attempts  int
+	notBefore time.Time // retries wait until then
+}
+
+// Queue deletes links in the background. A single dispatcher takes queued
+// IDs of all users in batches, groups them by owner and hands each group
+// to a worker.
+type Queue struct {
+	store   Deleter
+	opts    Options
+	logger  *zap.Logger
+	journal *journal
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	pending []item
+	closed  bool
+
+	// ctx is cancelled when Close gives up waiting for storage calls
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	wake     chan struct{}
+	stop     chan struct{}
+	stopped  chan struct{}
+	workers  *semaphore.Semaphore
+	inflight sync.WaitGroup
+}
+
+// New starts a queue deleting from store. Jobs are journaled to fileName,
+// and the unfinished ones found there are resumed; an empty fileName keeps
+// the queue in memory only.
+func New(store Deleter, fileName string, opts Options, logger *zap.Logger) (*Queue, error) {
+	q := &Queue{
+		store:   store,
+		opts:    opts.withDefaults(),
+		logger:  logger,
+		jobs:    make(map[string]*Job),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	q.workers = semaphore.NewSemaphore(q.opts.Workers)
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+
+	if fileName != "" {
+		records, err := readJournal(fileName)
+		if err != nil {
+			return nil, err
+		}
+		q.journal, err = openJournal(fileName, q.restore(records))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	go q.run()
+	return q, nil
+}
+
+// Enqueue accepts ids of userID for deletion and returns the new job.
+func (q *Queue) Enqueue(userID string, ids []string) (Job, error) {
+	q.mu.Lock()
+	closed := q.closed
+	q.mu.Unlock()
+	if closed {
+		return Job{}, ErrClosed
+	}
+
+	job := &Job{
+		ID:        newJobID(),
+		Status:    StatusPending,
+		Total:     len(ids),
+		CreatedAt: time.Now().UTC(),
+		userID:    userID,
+	}
+	op := opEnqueue
+	if job.Total == 0 {
+		op = opFinish
+	}
+	// If Close got past the check above, the journal rejects the record
+	// with ErrClosed
+	err := q.journal.append(record{
+		Op:        op,
+		JobID:     job.ID,
+		UserID:    userID,
+		ShortURLs: ids,
+		Total:     job.Total,
+		CreatedAt: job.CreatedAt,
+		Time:      job.CreatedAt,
+	})
+	if err != nil {
+		return Job{}, err
+	}
+
+	q.mu.Lock()
+	q.jobs[job.ID] = job
+	for _, id := range ids {
+		q.pending = append(q.pending, item{jobID: job.ID, userID: userID, shortURL: id})
+	}
+	if job.Total == 0 {
+		job.Status = StatusDone
+		job.finishedAt = job.CreatedAt
+	}
+	snapshot := *job
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return snapshot, nil
+}
+
+// Job returns the job id of userID.
+func (q *Queue) Job(id, userID string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok || job.userID != userID {
+		return Job{}, ErrNotFound
+	}
+	return *job, nil
+}
+
+// Close stops accepting jobs and deletes what is already queued, except
+// retries that are not due yet. When ctx expires, storage calls in flight
+// are cancelled and whatever is left stays in the journal for the next
+// start. Either way Close returns only after the last storage call, so the
+// storage can be closed right after it.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	q.mu.Unlock()
+
+	close(q.stop)
+	var err error
+	select {
+	case <-q.stopped:
+	case <-ctx.Done():
+		err = ctx.Err()
+		q.cancel()
+		// Storages that ignore ctx finish their call first
+		<-q.stopped
+	}
+	q.cancel()
+	if cerr := q.journal.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// restore rebuilds jobs from journal records and returns the records to
+// keep: finished jobs still within retention and unfinished jobs, which
+// are queued again.
+func (q *Queue) restore(records []record) []record {
+	latest := make(map[string]record)
+	var order []string
+	for _, r := range records {
+		if _, ok := latest[r.JobID]; !ok {
+			order = append(order, r.JobID)
+		}
+		latest[r.JobID] = r
+	}
+
+	var keep []record
+	for _, id := range order {
+		r := latest[id]
+		job := &Job{
+			ID:        r.JobID,
+			Status:    StatusPending,
+			Total:     r.Total,
+			CreatedAt: r.CreatedAt,
+			userID:    r.UserID,
+		}
+
+		if r.Op == opFinish {
+			if time.Since(r.Time) > q.opts.Retention {
+				continue
+			}
+			job.Status = StatusDone
+			if r.Failed > 0 {
+				job.Status = StatusFailed
+			}
+			job.Processed, job.Failed, job.Error = r.Processed, r.Failed, r.Error
+			job.finishedAt = r.Time
+		} else {
+			// Deleting twice is harmless, so the whole job is redone
+			for _, shortURL := range r.ShortURLs {
+				q.pending = append(q.pending, item{jobID: id, userID: r.UserID, shortURL: shortURL})
+			}
+		}
+		q.jobs[id] = job
+		keep = append(keep, r)
+	}
+	return keep
+}
+
+func (q *Queue) run() {
+	defer close(q.stopped)
+
+	ticker := time.NewTicker(q.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.wake:
+			q.flush(true)
+		case <-ticker.C:
+			q.flush(false)
+			q.expire()
+		case <-q.stop:
+			// Drain what is due, including retries of the last batches
+			for q.flush(false) {
+				q.inflight.Wait()
+			}
+			q.inflight.Wait()
+			return
+		}
+	}
+}
+
+// flush dispatches due items in batches. With fullOnly set, a partial
+// batch is left to wait for more items. It reports whether anything was
+// dispatched.
+func (q *Queue) flush(fullOnly bool) bool {
+	dispatched := false
+	for {
+		batch := q.take(fullOnly)
+		if len(batch) == 0 {
+			return dispatched
+		}
+		dispatched = true
+
+		// Each owner's IDs go to the storage in one call
+		groups := make(map[string][]item)
+		var owners []string
+		for _, it := range batch {
+			if _, ok := groups[it.userID]; !ok {
+				owners = append(owners, it.userID)
+			}
+			groups[it.userID] = append(groups[it.userID], it)
+		}
+		for _, userID := range owners {
+			q.workers.Acquire()
+			q.inflight.Add(1)
+			go func(userID string, items []item) {
+				defer q.inflight.Done()
+				defer q.workers.Release()
+				q.delete(userID, items)
+			}(userID, groups[userID])
+		}
+	}
+}
+
+// take removes up to BatchSize due items from the queue.
+func (q *Queue) take(fullOnly bool) []item {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	due := 0
+	for _, it := range q.pending {
+		if !it.notBefore.After(now) {
+			due++
+		}
+	}
+	if due == 0 || (fullOnly && due < q.opts.BatchSize) {
+		return nil
+	}
+
+	var batch []item
+	rest := q.pending[:0]
+	for _, it := range q.pending {
+		if len(batch) < q.opts.BatchSize && !it.notBefore.After(now) {
+			batch = append(batch, it)
+		} else {
+			rest = append(rest, it)
+		}
+	}
+	q.pending = rest
+	return batch
+}
+
+func (q *Queue) delete(userID string, items []item) {
+	ids := make([]string, len(items))
+	for i, it := range items {
+		ids[i] = it.shortURL
+	}
+
+	err := q.store.DeleteURLs(q.ctx, userID, ids)
+	if err == nil {
+		q.complete(items, nil)
+		return
+	}
+	if q.ctx.Err() != nil {
+		// Shutting down: the job is resumed from the journal on next start
+		return
+	}
+
+	// A batch mixes fresh items with retries, so each item counts its own
+	// attempts
+	var exhausted, retried []string
+	var failed []item
+	now := time.Now()
+	q.mu.Lock()
+	for _, it := range items {
+		it.attempts++
+		if it.attempts >= q.opts.MaxAttempts {
+			exhausted = append(exhausted, it.shortURL)
+			failed = append(failed, it)
+			continue
+		}
+		retried = append(retried, it.shortURL)
+		it.notBefore = now.Add(q.opts.RetryDelay << (it.attempts - 1))
+		q.pending = append(q.pending, it)
+	}
+	q.mu.Unlock()
+
+	if len(retried) > 0 {
+		q.logger.Warn("Failed to delete URLs, retrying",
+			zap.String("user_id", userID),
+			zap.Int("count", len(retried)),
+			zap.Error(err),
+		)
+	}
+	if len(exhausted) > 0 {
+		q.logger.Error("Giving up deleting URLs",
+			zap.String("user_id", userID),
+			zap.Strings("short_urls", exhausted),
+			zap.Int("attempts", q.opts.MaxAttempts),
+			zap.Error(err),
+		)
+		q.complete(failed, err)
+	}
+}
+
+// complete records the outcome of items and journals the jobs it finishes.
+func (q *Queue) complete(items []item, err error) {
+	var finished []record
+
+	q.mu.Lock()
+	now := time.Now().UTC()
+	for _, it := range items {
+		job, ok := q.jobs[it.jobID]
+		if !ok {
+			continue
+		}
+		if err != nil {
+			job.Failed++
+			job.Error = err.Error()
+		} else {
+			job.Processed++
+		}
+		if job.Processed+job.Failed < job.Total {
+			continue
+		}
+
+		job.Status = StatusDone
+		if job.Failed > 0 {
+			job.Status = StatusFailed
+		}
+		job.finishedAt = now
+		finished = append(finished, record{
+			Op:        opFinish,
+			JobID:     job.ID,
+			UserID:    job.userID,
+			Total:     job.Total,
+			Processed: job.Processed,
+			Failed:    job.Failed,
+			Error:     job.Error,
+			CreatedAt: job.CreatedAt,
+			Time:      now,
+		})
+	}
+	q.mu.Unlock()
+
+	for _, r := range finished {
+		if err := q.journal.append(r); err != nil {
+			q.logger.Error("Failed to journal finished deletion job",
+				zap.String("job_id", r.JobID),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// expire forgets finished jobs older than Retention.
+func (q *Queue) expire() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for id, job := range q.jobs {
+		if job.Status != StatusPending && time.Since(job.finishedAt) > q.opts.Retention {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,242 @@
+package deletion_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/vkobazev/goShortenerUrl/internal/deletion"
+)
+
+// recordingDeleter remembers successful DeleteURLs calls. The next failures
+// calls fail, all of them if failures is negative.
+type recordingDeleter struct {
+	mu       sync.Mutex
+	calls    [][]string
+	failures int
+	attempts int
+}
+
+func (d *recordingDeleter) DeleteURLs(ctx context.Context, userID string, ids []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.attempts++
+	if d.failures != 0 {
+		d.failures--
+		return errors.New("storage unavailable")
+	}
+	d.calls = append(d.calls, append([]string{userID}, ids...))
+	return nil
+}
+
+func (d *recordingDeleter) Calls() [][]string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([][]string(nil), d.calls...)
+}
+
+var testOptions = deletion.Options{
+	FlushInterval: 10 * time.Millisecond,
+	RetryDelay:    time.Millisecond,
+	MaxAttempts:   3,
+}
+
+func waitJob(t *testing.T, q *deletion.Queue, id, userID string) deletion.Job {
+	t.Helper()
+	var job deletion.Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = q.Job(id, userID)
+		require.NoError(t, err)
+		return job.Status != deletion.StatusPending
+	}, 2*time.Second, 5*time.Millisecond)
+	return job
+}
+
+func TestQueueFanIn(t *testing.T) {
+	d := &recordingDeleter{}
+	q, err := deletion.New(d, "", testOptions, zap.NewNop())
+	require.NoError(t, err)
+	defer q.Close(context.Background())
+
+	first, err := q.Enqueue("u1", []string{"a", "b"})
+	require.NoError(t, err)
+	assert.Equal(t, deletion.StatusPending, first.Status)
+	second, err := q.Enqueue("u1", []string{"c"})
+	require.NoError(t, err)
+	other, err := q.Enqueue("u2", []string{"d"})
+	require.NoError(t, err)
+
+	job := waitJob(t, q, first.ID, "u1")
+	assert.Equal(t, deletion.StatusDone, job.Status)
+	assert.Equal(t, 2, job.Processed)
+	waitJob(t, q, second.ID, "u1")
+	waitJob(t, q, other.ID, "u2")
+
+	// Both jobs of u1 went to the storage in one call
+	assert.ElementsMatch(t, [][]string{{"u1", "a", "b", "c"}, {"u2", "d"}}, d.Calls())
+
+	// Jobs are visible to their owner only
+	_, err = q.Job(first.ID, "u2")
+	assert.ErrorIs(t, err, deletion.ErrNotFound)
+}
+
+func TestQueueRetries(t *testing.T) {
+	d := &recordingDeleter{failures: 2}
+	q, err := deletion.New(d, "", testOptions, zap.NewNop())
+	require.NoError(t, err)
+
+	job, err := q.Enqueue("u1", []string{"a"})
+	require.NoError(t, err)
+	job = waitJob(t, q, job.ID, "u1")
+	assert.Equal(t, deletion.StatusDone, job.Status)
+	assert.Equal(t, 1, job.Processed)
+
+	// A batch that keeps failing is given up after MaxAttempts
+	d.mu.Lock()
+	d.failures = testOptions.MaxAttempts
+	d.mu.Unlock()
+	job, err = q.Enqueue("u1", []string{"b", "c"})
+	require.NoError(t, err)
+	job = waitJob(t, q, job.ID, "u1")
+	assert.Equal(t, deletion.StatusFailed, job.Status)
+	assert.Equal(t, 2, job.Failed)
+	assert.Equal(t, "storage unavailable", job.Error)
+
+	require.NoError(t, q.Close(context.Background()))
+	_, err = q.Enqueue("u1", []string{"d"})
+	assert.ErrorIs(t, err, deletion.ErrClosed)
+}
+
+func TestQueueRetriesCountPerItem(t *testing.T) {
+	d := &recordingDeleter{failures: 2}
+	opts := deletion.Options{FlushInterval: 50 * time.Millisecond, RetryDelay: time.Millisecond, MaxAttempts: 2}
+	q, err := deletion.New(d, "", opts, zap.NewNop())
+	require.NoError(t, err)
+	defer q.Close(context.Background())
+
+	last, err := q.Enqueue("u1", []string{"a"})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.attempts == 1
+	}, 2*time.Second, time.Millisecond)
+
+	// The fresh item shares the next batch with the last retry of "a"
+	fresh, err := q.Enqueue("u1", []string{"b"})
+	require.NoError(t, err)
+
+	job := waitJob(t, q, last.ID, "u1")
+	assert.Equal(t, deletion.StatusFailed, job.Status)
+	job = waitJob(t, q, fresh.ID, "u1")
+	assert.Equal(t, deletion.StatusDone, job.Status)
+	assert.Equal(t, [][]string{{"u1", "b"}}, d.Calls())
+}
+
+func TestQueueRestart(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "delete_queue.json")
+
+	// The storage is down for longer than the first run lasts
+	d := &recordingDeleter{failures: -1}
+	q, err := deletion.New(d, fileName, deletion.Options{RetryDelay: time.Hour}, zap.NewNop())
+	require.NoError(t, err)
+	pending, err := q.Enqueue("u1", []string{"a", "b"})
+	require.NoError(t, err)
+	done, err := q.Enqueue("u2", []string{})
+	require.NoError(t, err)
+	require.NoError(t, q.Close(context.Background()))
+
+	d = &recordingDeleter{}
+	q, err = deletion.New(d, fileName, testOptions, zap.NewNop())
+	require.NoError(t, err)
+	defer q.Close(context.Background())
+
+	job := waitJob(t, q, pending.ID, "u1")
+	assert.Equal(t, deletion.StatusDone, job.Status)
+	assert.Equal(t, [][]string{{"u1", "a", "b"}}, d.Calls())
+
+	job, err = q.Job(done.ID, "u2")
+	require.NoError(t, err)
+	assert.Equal(t, deletion.StatusDone, job.Status)
+}
+
+// stuckDeleter blocks until its context is cancelled.
+type stuckDeleter struct {
+	entered chan struct{}
+}
+
+func (d stuckDeleter) DeleteURLs(ctx context.Context, userID string, ids []string) error {
+	close(d.entered)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestQueueCloseDeadline(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "delete_queue.json")
+
+	d := stuckDeleter{entered: make(chan struct{})}
+	q, err := deletion.New(d, fileName, testOptions, zap.NewNop())
+	require.NoError(t, err)
+	job, err := q.Enqueue("u1", []string{"a"})
+	require.NoError(t, err)
+	<-d.entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, q.Close(ctx), context.DeadlineExceeded)
+
+	// The unfinished job is picked up by the next start
+	r := &recordingDeleter{}
+	q, err = deletion.New(r, fileName, testOptions, zap.NewNop())
+	require.NoError(t, err)
+	defer q.Close(context.Background())
+	waitJob(t, q, job.ID, "u1")
+	assert.Equal(t, [][]string{{"u1", "a"}}, r.Calls())
+}
+
+// deafDeleter ignores its context and blocks until release is closed.
+type deafDeleter struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (d deafDeleter) DeleteURLs(ctx context.Context, userID string, ids []string) error {
+	close(d.entered)
+	<-d.release
+	return nil
+}
+
+func TestQueueCloseWaitsForWorkers(t *testing.T) {
+	d := deafDeleter{entered: make(chan struct{}), release: make(chan struct{})}
+	q, err := deletion.New(d, "", testOptions, zap.NewNop())
+	require.NoError(t, err)
+	_, err = q.Enqueue("u1", []string{"a"})
+	require.NoError(t, err)
+	<-d.entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	closed := make(chan error)
+	go func() { closed <- q.Close(ctx) }()
+
+	// The deadline passes, but the storage call is still running
+	select {
+	case <-closed:
+		t.Fatal("Close returned before the storage call finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(d.release)
+	assert.ErrorIs(t, <-closed, context.DeadlineExceeded)
+
+	_, err = q.Enqueue("u1", []string{"b"})
+	assert.ErrorIs(t, err, deletion.ErrClosed)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	MinAliasLength = 3
+	MaxAliasLength = 64
+)
+
+// defaultReserved are route names that cannot become short links even
+// before SetupEcho reserves the routes it registers.
+var defaultReserved = []string{"api", "ping", "debug"}
+
+var (
+	errAliasLength  = fmt.Errorf("alias must be %d to %d characters long", MinAliasLength, MaxAliasLength)
+	errAliasCharset = errors.New("alias may only contain letters, digits, '-' and '_'")
+	errAliasBlocked = errors.New("alias contains a blocked word")
+
+	errCorrelationEmpty   = errors.New("correlation_id is required")
+	errCorrelationCharset = errors.New("correlation_id may only contain letters, digits, '-' and '_'")
+)
+
+// Reserve keeps the first segment of route path from being used as a short
+// ID, since the route would shadow the link. Parameter and wildcard
+// segments reserve nothing.
+func (sh *URLShortener) Reserve(path string) {
+	segment, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if segment == "" || strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+		return
+	}
+	sh.reserved[strings.ToLower(segment)] = true
+}
+
+// isReserved reports whether id collides with a route.
+func (sh *URLShortener) isReserved(id string) bool {
+	return sh.reserved[strings.ToLower(id)]
+}
+
+// validateAlias checks a user-chosen short ID. The error explains what is
+// wrong and can be shown to the client.
+func (sh *URLShortener) validateAlias(alias string) error {
+	if len(alias) < MinAliasLength || len(alias) > MaxAliasLength {
+		return errAliasLength
+	}
+	if !pathSafe(alias) {
+		return errAliasCharset
+	}
+	if sh.isReserved(alias) {
+		return fmt.Errorf("alias %q is reserved", alias)
+	}
+	if sh.Filter.Blocked(alias) {
+		return errAliasBlocked
+	}
+	return nil
+}
+
+// validateCorrelationID checks a batch correlation ID that becomes the
+// short ID. Clients pick these as keys rather than names, often counters
+// or UUIDs, so only what would break the link is rejected.
+func (sh *URLShortener) validateCorrelationID(id string) error {
+	if id == "" {
+		return errCorrelationEmpty
+	}
+	if !pathSafe(id) {
+		return errCorrelationCharset
+	}
+	if sh.isReserved(id) {
+		return fmt.Errorf("correlation_id %q is reserved", id)
+	}
+	return nil
+}
+
+// pathSafe reports whether id only holds letters, digits, '-' and '_'.
+func pathSafe(id string) bool {
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -2,45 +2,80 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/labstack/echo/v4"
 	"github.com/vkobazev/goShortenerUrl/internal/config"
 	"github.com/vkobazev/goShortenerUrl/internal/consts"
-	"github.com/vkobazev/goShortenerUrl/internal/data"
 	"github.com/vkobazev/goShortenerUrl/internal/database"
+	"github.com/vkobazev/goShortenerUrl/internal/deletion"
+	"github.com/vkobazev/goShortenerUrl/internal/idgen"
 	jwt "github.com/vkobazev/goShortenerUrl/internal/jwt"
+	"github.com/vkobazev/goShortenerUrl/internal/storage"
+	"go.uber.org/zap"
 	"io"
-	"log"
-	"math/rand"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type URLShortener struct {
-	Counter uint
-	URLS    map[string]string
-	ReURLS  map[string]string
-	Tests   bool
-	DB      *database.DB
+	Storage   storage.Storage
+	Deletions *deletion.Queue
+	IDs       idgen.IDGenerator
+	Filter    *idgen.Filter // rejects IDs and aliases with blocked words
+	Logger    *zap.Logger
+
+	// reserved holds lower-cased IDs that routes would shadow
+	reserved map[string]bool
 }
 
+// maxIDAttempts bounds how many generated IDs StoreURL tries before giving
+// up on a link.
+const maxIDAttempts = 10
+
 type ShortResponse struct {
 	Result string `json:"result"`
 	UserID string `json:"user_id,omitempty"`
 }
 
+type TrashResponse struct {
+	ShortURL    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url"`
+	DeletedAt   time.Time `json:"deleted_at"`
+	// PurgeAt is when the link is removed for good, if ever.
+	PurgeAt *time.Time `json:"purge_at,omitempty"`
+}
+
+// BatchRequest is one link of a batch. Its short ID is Alias if set, or the
+// correlation ID otherwise.
+type BatchRequest struct {
+	database.RequestData
+	Alias string `json:"alias,omitempty"`
+}
+
 type LongResponse struct {
 	ID       string `json:"correlation_id"`
-	ShortURL string `json:"short_url"`
+	ShortURL string `json:"short_url,omitempty"`
 	UserID   string `json:"user_id,omitempty"`
+	// Conflict is set when the URL was not stored: the user already has it
+	// under ShortURL, or the alias or correlation ID is taken and ShortURL
+	// is empty.
+	Conflict bool `json:"conflict,omitempty"`
 }
 
-func NewShortList() *URLShortener {
-	return &URLShortener{
-		Counter: 0,
-		URLS:    make(map[string]string),
-		ReURLS:  make(map[string]string),
-		Tests:   false,
+func NewShortList(s storage.Storage, q *deletion.Queue, l *zap.Logger) *URLShortener {
+	sh := &URLShortener{
+		Storage:   s,
+		Deletions: q,
+		IDs:       idgen.NewRandom(idgen.Alphabet, consts.ShortURLLength),
+		Logger:    l,
+		reserved:  make(map[string]bool),
+	}
+	for _, name := range defaultReserved {
+		sh.Reserve(name)
 	}
+	return sh
 }
 
 func (sh *URLShortener) CreateShortURL(c echo.Context) error {
@@ -56,14 +91,14 @@ func (sh *URLShortener) CreateShortURL(c echo.Context) error {
 	}
 
 	longURL := string(body)
-	shortURL, err := sh.StoreURL(longURL, userID)
+	shortURL, err := sh.StoreURL(c.Request().Context(), longURL, userID, 0)
 	if err != nil {
-		if err.Error() == "conflict" {
+		if errors.Is(err, storage.ErrConflict) {
 			c.Response().Header().Set("Content-Type", "text/plain; charset=UTF-8")
 			c.Response().WriteHeader(http.StatusConflict)
 			return c.String(http.StatusConflict, shortURL)
 		}
-		return c.String(http.StatusInternalServerError, "Internal server error")
+		return sh.storageFailure(c, err)
 	}
 
 	c.Response().Header().Set("Content-Type", "text/plain; charset=UTF-8")
@@ -75,16 +110,20 @@ func (sh *URLShortener) GetLongURL(c echo.Context) error {
 
 	id := c.Param("id")
 
-	longURL, _, err, deleted := sh.RetrieveURL(id)
-	if err != nil {
+	link, err := sh.RetrieveURL(c.Request().Context(), id)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
 		return c.String(http.StatusNotFound, "Short URL not found")
-	}
-	if deleted {
+	case errors.Is(err, storage.ErrDeleted):
 		return c.String(http.StatusGone, "410 Gone")
+	case err != nil:
+		return sh.storageFailure(c, err)
 	}
 
+	status := redirectStatus(link.Redirect)
 	c.Response().Header().Set("Content-Type", "text/plain; charset=UTF-8")
-	return c.Redirect(http.StatusTemporaryRedirect, longURL)
+	c.Response().Header().Set("Cache-Control", redirectCacheControl(status))
+	return c.Redirect(status, link.OriginalURL)
 }
 
 func (sh *URLShortener) APIReturnShortURL(c echo.Context) error {
@@ -92,7 +131,9 @@ func (sh *URLShortener) APIReturnShortURL(c echo.Context) error {
 	userID := c.Get(jwt.UserIDKey).(string)
 
 	var requestData struct {
-		URL string `json:"url"`
+		URL      string `json:"url"`
+		Alias    string `json:"alias"`
+		Redirect int    `json:"redirect"`
 	}
 
 	if err := c.Bind(&requestData); err != nil {
@@ -101,17 +142,34 @@ func (sh *URLShortener) APIReturnShortURL(c echo.Context) error {
 	if requestData.URL == "" {
 		return c.String(http.StatusBadRequest, "Body is empty")
 	}
+	if err := validateRedirect(requestData.Redirect); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
 
-	shortURL, err := sh.StoreURL(requestData.URL, userID)
+	var shortURL string
+	var err error
+	if requestData.Alias != "" {
+		if err := sh.validateAlias(requestData.Alias); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		shortURL, err = sh.StoreAlias(c.Request().Context(), requestData.Alias, requestData.URL, userID, requestData.Redirect)
+	} else {
+		shortURL, err = sh.StoreURL(c.Request().Context(), requestData.URL, userID, requestData.Redirect)
+	}
 	if err != nil {
-		if err.Error() == "conflict" {
+		if errors.Is(err, storage.ErrIDTaken) {
+			return c.JSON(http.StatusConflict, echo.Map{
+				"message": "Alias is already taken",
+			})
+		}
+		if errors.Is(err, storage.ErrConflict) {
 			response := ShortResponse{
 				Result: shortURL,
 				UserID: userID,
 			}
 			return c.JSON(http.StatusConflict, response)
 		}
-		return c.String(http.StatusInternalServerError, "Internal server error")
+		return sh.storageFailure(c, err)
 	}
 
 	response := ShortResponse{
@@ -125,41 +183,107 @@ func (sh *URLShortener) APIPutMassiveData(c echo.Context) error {
 
 	userID := c.Get(jwt.UserIDKey).(string)
 
-	var requestDataSlice []database.RequestData
+	var requestDataSlice []BatchRequest
 	if err := c.Bind(&requestDataSlice); err != nil {
 		return c.String(http.StatusBadRequest, "Read Body failed")
 	}
 
-	// Add userID to each request
+	// Add userID to each request, rejecting the whole batch on a bad short
+	// ID or redirect. Without an alias the correlation ID becomes the short
+	// ID, so it must not shadow a route or break the link.
 	for i := range requestDataSlice {
 		requestDataSlice[i].UserID = userID
+		var err error
+		if requestDataSlice[i].Alias != "" {
+			err = sh.validateAlias(requestDataSlice[i].Alias)
+		} else {
+			err = sh.validateCorrelationID(requestDataSlice[i].ID)
+		}
+		if err != nil {
+			return c.String(http.StatusBadRequest, fmt.Sprintf("%s: %s", requestDataSlice[i].ID, err))
+		}
+		if err := validateRedirect(requestDataSlice[i].Redirect); err != nil {
+			return c.String(http.StatusBadRequest, fmt.Sprintf("%s: %s", requestDataSlice[i].ID, err))
+		}
 	}
 
-	response, err := sh.StoreURLBatch(requestDataSlice)
+	response, err := sh.StoreURLBatch(c.Request().Context(), requestDataSlice)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "Internal server error")
+		return sh.storageFailure(c, err)
 	}
 
 	return c.JSON(http.StatusCreated, response)
 }
 
+// APIReturnUserData lists the links of the user. Deleted links are left
+// out unless the deleted query parameter is true.
 func (sh *URLShortener) APIReturnUserData(c echo.Context) error {
 
 	userID := c.Get(jwt.UserIDKey).(string)
 
-	urls, err := sh.DB.GetURLsByUser(context.Background(), userID)
+	includeDeleted := false
+	if param := c.QueryParam("deleted"); param != "" {
+		var err error
+		if includeDeleted, err = strconv.ParseBool(param); err != nil {
+			return c.String(http.StatusBadRequest, "deleted must be true or false")
+		}
+	}
+
+	urls, err := sh.Storage.GetURLsByUser(c.Request().Context(), userID)
 	if err != nil {
+		sh.Logger.Error("Failed to retrieve user URLs", zap.String("user_id", userID), zap.Error(err))
 		return c.JSON(http.StatusInternalServerError, echo.Map{
 			"message": "Failed to retrieve user URLs",
 		})
 	}
+	if includeDeleted {
+		deleted, err := sh.Storage.GetDeletedURLsByUser(c.Request().Context(), userID, time.Time{})
+		if err != nil {
+			return sh.storageFailure(c, err)
+		}
+		for _, u := range deleted {
+			urls = append(urls, database.URLResponse{ShortURL: u.ShortURL, OriginalURL: u.OriginalURL, Deleted: true})
+		}
+	}
 	if urls == nil {
 		return c.JSON(http.StatusUnauthorized, urls)
 	}
 
+	host := returnHost()
+	for i := range urls {
+		urls[i].ShortURL = host + "/" + urls[i].ShortURL
+	}
+
 	return c.JSON(http.StatusOK, urls)
 }
 
+// APIUpdateUserURL changes the redirect status of a link of the user.
+func (sh *URLShortener) APIUpdateUserURL(c echo.Context) error {
+	userID := c.Get(jwt.UserIDKey).(string)
+
+	var requestData struct {
+		Redirect *int `json:"redirect"`
+	}
+	if err := c.Bind(&requestData); err != nil {
+		return c.String(http.StatusBadRequest, "Invalid request body")
+	}
+	if requestData.Redirect == nil {
+		return c.String(http.StatusBadRequest, "Nothing to update")
+	}
+	if err := validateRedirect(*requestData.Redirect); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	err := sh.Storage.SetRedirect(c.Request().Context(), userID, c.Param("id"), *requestData.Redirect)
+	if errors.Is(err, storage.ErrNotFound) {
+		return c.String(http.StatusNotFound, "Short URL not found")
+	}
+	if err != nil {
+		return sh.storageFailure(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
 func (sh *URLShortener) APIDeleteUserURLs(c echo.Context) error {
 	userID := c.Get(jwt.UserIDKey).(string)
 
@@ -172,49 +296,100 @@ func (sh *URLShortener) APIDeleteUserURLs(c echo.Context) error {
 		return c.NoContent(http.StatusAccepted)
 	}
 
-	ctx := context.Background()
-	const batchSize = 100
-	const numWorkers = 5
-
-	batch := func(urls []string, size int) [][]string {
-		var batches [][]string
-		for size < len(urls) {
-			urls, batches = urls[size:], append(batches, urls[0:size:size])
-		}
-		if len(urls) > 0 {
-			batches = append(batches, urls)
+	job, err := sh.Deletions.Enqueue(userID, shortURLs)
+	if err != nil {
+		if errors.Is(err, deletion.ErrClosed) {
+			return c.String(http.StatusServiceUnavailable, "Server is shutting down")
 		}
-		return batches
+		return sh.storageFailure(c, err)
 	}
+	return c.JSON(http.StatusAccepted, job)
+}
 
-	batches := batch(shortURLs, batchSize)
-	jobs := make(chan []string, len(batches))
-	results := make(chan error, len(batches))
+func (sh *URLShortener) APIDeleteStatus(c echo.Context) error {
+	userID := c.Get(jwt.UserIDKey).(string)
 
-	for w := 0; w < numWorkers; w++ {
-		go func() {
-			for batch := range jobs {
-				err := sh.DB.DeleteURLforUser(ctx, userID, batch)
-				results <- err
-			}
-		}()
+	job, err := sh.Deletions.Job(c.Param("job"), userID)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Deletion job not found")
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+func (sh *URLShortener) APIReturnUserTrash(c echo.Context) error {
+	userID := c.Get(jwt.UserIDKey).(string)
+
+	urls, err := sh.Storage.GetDeletedURLsByUser(c.Request().Context(), userID, restoreCutoff())
+	if err != nil {
+		return sh.storageFailure(c, err)
+	}
+	if len(urls) == 0 {
+		return c.NoContent(http.StatusNoContent)
 	}
 
-	go func() {
-		for _, batch := range batches {
-			jobs <- batch
+	host := returnHost()
+	response := make([]TrashResponse, len(urls))
+	for i, u := range urls {
+		response[i] = TrashResponse{
+			ShortURL:    host + "/" + u.ShortURL,
+			OriginalURL: u.OriginalURL,
+			DeletedAt:   u.DeletedAt,
+		}
+		if config.Options.PurgeAfter > 0 {
+			purgeAt := u.DeletedAt.Add(config.Options.PurgeAfter)
+			response[i].PurgeAt = &purgeAt
 		}
-		close(jobs)
-	}()
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+func (sh *URLShortener) APIRestoreUserURLs(c echo.Context) error {
+	userID := c.Get(jwt.UserIDKey).(string)
+
+	var shortURLs []string
+	if err := c.Bind(&shortURLs); err != nil {
+		return c.String(http.StatusBadRequest, "Invalid request body")
+	}
 
-	return c.NoContent(http.StatusAccepted)
+	restored, err := sh.Storage.RestoreURLs(c.Request().Context(), userID, shortURLs, restoreCutoff())
+	if err != nil {
+		return sh.storageFailure(c, err)
+	}
+	if restored == nil {
+		restored = []string{}
+	}
+	return c.JSON(http.StatusOK, restored)
 }
 
 // Helper functions
 
+// restoreCutoff returns the earliest deletion time that can still be
+// restored: older links are due to be purged.
+func restoreCutoff() time.Time {
+	if config.Options.PurgeAfter <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-config.Options.PurgeAfter)
+}
+
+// storageFailure logs a failed storage call and answers with 503 if the
+// storage timed out, or 500 otherwise.
+func (sh *URLShortener) storageFailure(c echo.Context, err error) error {
+	sh.Logger.Error("Storage request failed",
+		zap.String("method", c.Request().Method),
+		zap.String("uri", c.Request().RequestURI),
+		zap.Error(err),
+	)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return c.String(http.StatusServiceUnavailable, "Service unavailable")
+	}
+	return c.String(http.StatusInternalServerError, "Internal server error")
+}
+
 func (sh *URLShortener) PingDB(c echo.Context) error {
-	err := sh.DB.Ping(context.Background())
+	err := sh.Storage.Ping(c.Request().Context())
 	if err != nil {
+		sh.Logger.Error("Storage ping failed", zap.Error(err))
 		return c.String(http.StatusInternalServerError, "500 Internal Server Error")
 	}
 
@@ -223,134 +398,106 @@ func (sh *URLShortener) PingDB(c echo.Context) error {
 	return c.String(http.StatusOK, "OK")
 }
 
-func GenRandomID(num int) string {
-	var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
-
-	str := make([]rune, num)
-	for i := range str {
-		str[i] = letters[rand.Intn(len(letters))]
+func returnHost() string {
+	host := config.Options.ReturnAddr
+	if host == "" {
+		host = consts.HTTPMethod + "://" + "localhost:8080"
 	}
-	return string(str)
+	return host
 }
 
 // Business logic functions
 
-func (sh *URLShortener) StoreURL(longURL, userID string) (string, error) {
-	id := GenRandomID(consts.ShortURLLength)
-	host := config.Options.ReturnAddr
-	if host == "" {
-		host = consts.HTTPMethod + "://" + "localhost:8080"
-	}
-	shortURL := host + "/" + id
+func (sh *URLShortener) StoreURL(ctx context.Context, longURL, userID string, redirect int) (string, error) {
+	host := returnHost()
 
-	switch {
-	case config.Options.DataBaseConn == "":
-		oldID, ok := sh.ReURLS[longURL]
-		if !ok {
-			sh.URLS[id] = longURL
-			sh.ReURLS[longURL] = id
-			sh.Counter++
-
-			if !sh.Tests {
-				err := data.P.WriteEvent(&data.Event{
-					ID:     sh.Counter,
-					Short:  id,
-					Long:   longURL,
-					UserID: userID,
-				})
-				if err != nil {
-					log.Fatalf("Error writing Event: %v", err)
-				}
-			}
-			return shortURL, nil
-		} else {
-			shortURL = host + "/" + oldID
-			return shortURL, fmt.Errorf("conflict")
+	// The storage refuses taken IDs, so a collision costs another attempt
+	for attempt := 0; attempt < maxIDAttempts; attempt++ {
+		id := sh.IDs.Generate(longURL, userID, attempt)
+		if sh.isReserved(id) || sh.Filter.Blocked(id) {
+			continue
 		}
-	default:
-		exists, err := sh.DB.LongURLExists(context.Background(), longURL, userID)
-		if err != nil {
-			log.Fatalf("Error checking long URL existence: %v", err)
+		storedID, err := sh.Storage.Store(ctx, id, longURL, userID, redirect)
+		if errors.Is(err, storage.ErrIDTaken) {
+			continue
 		}
-		if exists {
-			oldID, err := sh.DB.GetShortURL(context.Background(), longURL, userID)
-			if err != nil {
-				return "", err
-			}
-			shortURL = host + "/" + oldID
-			return shortURL, fmt.Errorf("conflict")
-		} else {
-			err = sh.DB.InsertURL(context.Background(), id, longURL, userID)
-			if err != nil {
-				log.Fatalf("Error inserting URL: %v", err)
-			}
-			return shortURL, nil
+		if errors.Is(err, storage.ErrConflict) {
+			return host + "/" + storedID, err
+		}
+		if err != nil {
+			return "", fmt.Errorf("storing URL: %w", err)
 		}
+		sh.recordStored(1)
+		return host + "/" + storedID, nil
 	}
+	return "", fmt.Errorf("storing URL: no free ID after %d attempts", maxIDAttempts)
 }
 
-func (sh *URLShortener) RetrieveURL(id string) (string, string, error, bool) {
-	switch {
-	case config.Options.DataBaseConn == "":
-		longURL, ok := sh.URLS[id]
-		if !ok {
-			return "", "", fmt.Errorf("not found"), false
-		}
-		return longURL, "", nil, false
-	default:
-		_, deleted, err := sh.DB.LongURLDeleted(context.Background(), id)
-		if err != nil {
-			return "", "", err, false
-		}
-		if deleted {
-			return "", "", err, deleted
-		}
+// StoreAlias saves longURL under the alias chosen by the user, which must
+// be valid. It returns storage.ErrIDTaken if the alias belongs to another
+// link, or the existing short URL with storage.ErrConflict if the user
+// already has longURL.
+func (sh *URLShortener) StoreAlias(ctx context.Context, alias, longURL, userID string, redirect int) (string, error) {
+	host := returnHost()
 
-		longURL, userID, err := sh.DB.GetLongURL(context.Background(), id)
-		if err != nil {
-			return "", "", err, false
-		}
-		return longURL, userID, nil, false
+	storedID, err := sh.Storage.Store(ctx, alias, longURL, userID, redirect)
+	if errors.Is(err, storage.ErrConflict) {
+		return host + "/" + storedID, err
+	}
+	if errors.Is(err, storage.ErrIDTaken) {
+		return "", err
 	}
+	if err != nil {
+		return "", fmt.Errorf("storing URL: %w", err)
+	}
+	sh.recordStored(1)
+	return host + "/" + storedID, nil
 }
 
-func (sh *URLShortener) StoreURLBatch(requestDataSlice []database.RequestData) ([]LongResponse, error) {
-	host := config.Options.ReturnAddr
-	if host == "" {
-		host = consts.HTTPMethod + "://" + "localhost:8080"
+// recordStored tells the ID generator about n new links if it keeps count.
+func (sh *URLShortener) recordStored(n int) {
+	if r, ok := sh.IDs.(idgen.Recorder); ok && n > 0 {
+		r.Stored(n)
 	}
+}
 
-	switch {
-	case config.Options.DataBaseConn == "":
-		for _, pair := range requestDataSlice {
-			sh.URLS[pair.ID] = pair.URL
-			sh.ReURLS[pair.URL] = pair.ID
-			sh.Counter++
-
-			// Event writing
-			if !sh.Tests {
-				err := data.P.WriteEvent(&data.Event{
-					ID:    sh.Counter,
-					Short: pair.ID,
-					Long:  pair.URL,
-				})
-				if err != nil {
-					log.Fatalf("Error writing Event: %v", err)
-				}
-			}
+// RetrieveURL returns the link stored as id, or storage.ErrNotFound or
+// storage.ErrDeleted.
+func (sh *URLShortener) RetrieveURL(ctx context.Context, id string) (storage.Link, error) {
+	return sh.Storage.Get(ctx, id)
+}
+
+func (sh *URLShortener) StoreURLBatch(ctx context.Context, requestDataSlice []BatchRequest) ([]LongResponse, error) {
+	host := returnHost()
+
+	pairs := make([]database.RequestData, len(requestDataSlice))
+	for i, r := range requestDataSlice {
+		pairs[i] = r.RequestData
+		if r.Alias != "" {
+			pairs[i].ID = r.Alias
 		}
-	default:
-		err := sh.DB.InsertURLs(context.Background(), requestDataSlice)
-		if err != nil {
-			log.Fatalf("Error inserting URLs: %v", err)
+	}
+	results, err := sh.Storage.StoreBatch(ctx, pairs)
+	if err != nil {
+		return nil, fmt.Errorf("inserting URLs: %w", err)
+	}
+
+	stored := 0
+	for _, result := range results {
+		if !result.Conflict {
+			stored++
 		}
 	}
+	sh.recordStored(stored)
 
 	var response []LongResponse
-	for _, pair := range requestDataSlice {
+	for i, pair := range requestDataSlice {
 		long := LongResponse{
 			ID:       pair.ID,
-			ShortURL: host + "/" + pair.ID,
+			Conflict: results[i].Conflict,
+		}
+		if results[i].ShortURL != "" {
+			long.ShortURL = host + "/" + results[i].ShortURL
 		}
 		response = append(response, long)
 	}
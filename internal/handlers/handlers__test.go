@@ -1,17 +1,31 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vkobazev/goShortenerUrl/internal/config"
+	"github.com/vkobazev/goShortenerUrl/internal/database"
+	"github.com/vkobazev/goShortenerUrl/internal/deletion"
+	"github.com/vkobazev/goShortenerUrl/internal/idgen"
 	"github.com/vkobazev/goShortenerUrl/internal/jwt"
+	"github.com/vkobazev/goShortenerUrl/internal/storage"
 	"io"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestCreateShortURL(t *testing.T) {
@@ -79,6 +93,20 @@ func TestCreateShortURL(t *testing.T) {
 				responseBody: "Body is empty",
 			},
 		},
+		{
+			testName:    "API POST batch - taken ID reported as conflict",
+			httpMethod:  http.MethodPost,
+			requestPath: "/api/shorten/batch",
+			requestBody: `[{"correlation_id":"abc123","original_url":"https://other.example"},` +
+				`{"correlation_id":"new123","original_url":"https://new.example"}]`,
+			testUrls: map[string]string{"abc123": "https://example.com"},
+			wantResult: wantResult{
+				contentType: "application/json",
+				statusCode:  http.StatusCreated,
+				responseBody: `^\[{"correlation_id":"abc123","conflict":true},` +
+					`{"correlation_id":"new123","short_url":"http://localhost:8080/new123"}\]`,
+			},
+		},
 		{
 			testName:    "GET request - valid short URL",
 			httpMethod:  http.MethodGet,
@@ -111,19 +139,19 @@ func TestCreateShortURL(t *testing.T) {
 			e := echo.New()
 			e.Use(jwt.JWTMiddleware())
 
-			// Устанавливаем глобальную переменную URLShortener
-			sh := URLShortener{
-				0,
-				tt.testUrls,
-				make(map[string]string),
-				true,
-				nil,
+			// Заполняем хранилище в памяти тестовыми ссылками
+			s := storage.NewMemory()
+			for id, long := range tt.testUrls {
+				_, err := s.StoreBatch(context.Background(), []database.RequestData{{ID: id, URL: long}})
+				require.NoError(t, err)
 			}
+			sh := NewShortList(s, nil, zap.NewNop())
 
 			// Регистрируем обработчики
 			e.POST("/", sh.CreateShortURL)
 			e.GET("/:id", sh.GetLongURL)
 			e.POST("/api/shorten", sh.APIReturnShortURL)
+			e.POST("/api/shorten/batch", sh.APIPutMassiveData)
 
 			// Создаем тестовый сервер
 			server := httptest.NewServer(e)
@@ -143,7 +171,7 @@ func TestCreateShortURL(t *testing.T) {
 			var resp *http.Response
 			var err error
 			if tt.httpMethod == http.MethodPost {
-				if tt.requestPath == "/api/shorten" {
+				if strings.HasPrefix(tt.requestPath, "/api/") {
 					resp, err = client.Post(url, "application/json", strings.NewReader(tt.requestBody))
 
 					require.NoError(t, err)
@@ -181,3 +209,629 @@ func TestCreateShortURL(t *testing.T) {
 		})
 	}
 }
+
+// TestConcurrentRequests is meant to be run with -race.
+func TestConcurrentRequests(t *testing.T) {
+	const workers = 16
+	const perWorker = 25
+
+	e := echo.New()
+	e.Use(jwt.JWTMiddleware())
+
+	sh := NewShortList(storage.NewMemory(), nil, zap.NewNop())
+	e.POST("/", sh.CreateShortURL)
+	e.GET("/:id", sh.GetLongURL)
+	e.POST("/api/shorten/batch", sh.APIPutMassiveData)
+
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				long := fmt.Sprintf("https://example.com/%d/%d", w, i)
+
+				// Создание короткой ссылки
+				resp, err := client.Post(server.URL+"/", "text/plain", strings.NewReader(long))
+				if !assert.NoError(t, err) {
+					return
+				}
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+				// Переход по ней
+				id := string(body)[strings.LastIndex(string(body), "/"):]
+				resp, err = client.Get(server.URL + id)
+				if !assert.NoError(t, err) {
+					return
+				}
+				resp.Body.Close()
+				assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+				assert.Equal(t, long, resp.Header.Get("Location"))
+
+				// Пакетное создание
+				batch := fmt.Sprintf(`[{"correlation_id":"b%d-%d","original_url":"%s/batch"}]`, w, i, long)
+				resp, err = client.Post(server.URL+"/api/shorten/batch", "application/json", strings.NewReader(batch))
+				if !assert.NoError(t, err) {
+					return
+				}
+				resp.Body.Close()
+				assert.Equal(t, http.StatusCreated, resp.StatusCode)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+// errStorage отвечает на любой запрос ссылки ошибкой err
+type errStorage struct {
+	storage.Storage
+	err error
+}
+
+func (s errStorage) Get(context.Context, string) (storage.Link, error) {
+	return storage.Link{}, s.err
+}
+
+func TestGetLongURLErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		statusCode int
+	}{
+		{"not found", fmt.Errorf("lookup: %w", storage.ErrNotFound), http.StatusNotFound},
+		{"deleted", fmt.Errorf("lookup: %w", storage.ErrDeleted), http.StatusGone},
+		{"backend failure", fmt.Errorf("connection refused"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			sh := NewShortList(errStorage{Storage: storage.NewMemory(), err: tt.err}, nil, zap.NewNop())
+			e.GET("/:id", sh.GetLongURL)
+
+			req := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			// Ошибки хранилища различаются через errors.Is, даже обернутые
+			assert.Equal(t, tt.statusCode, rec.Code)
+		})
+	}
+}
+
+// fixedID всегда предлагает один и тот же идентификатор
+type fixedID string
+
+func (id fixedID) Generate(_, _ string, _ int) string {
+	return string(id)
+}
+
+func TestStoreURLRetriesTakenID(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemory()
+	sh := NewShortList(s, nil, zap.NewNop())
+	sh.IDs = idgen.NewCounter(idgen.Alphabet, 0)
+
+	// Первые два идентификатора счетчика уже заняты чужими ссылками
+	for _, id := range []string{"a", "b"} {
+		_, err := s.Store(ctx, id, "https://other.example/"+id, "other", 0)
+		require.NoError(t, err)
+	}
+
+	shortURL, err := sh.StoreURL(ctx, "https://retry.example", "user", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/c", shortURL)
+
+	// Чужие ссылки не перезаписаны
+	got, err := s.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "https://other.example/a", got.OriginalURL)
+
+	// Если свободного идентификатора нет, запрос завершается ошибкой
+	sh.IDs = fixedID("a")
+	_, err = sh.StoreURL(ctx, "https://stuck.example", "user", 0)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, storage.ErrConflict)
+}
+
+// faultyStorage отказывает на каждом запросе, пока задана ошибка fault
+type faultyStorage struct {
+	storage.Storage
+	mu    sync.Mutex
+	fault error
+}
+
+func (s *faultyStorage) setFault(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fault = err
+}
+
+func (s *faultyStorage) err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fault
+}
+
+func (s *faultyStorage) Store(ctx context.Context, id, longURL, userID string, redirect int) (string, error) {
+	if err := s.err(); err != nil {
+		return "", err
+	}
+	return s.Storage.Store(ctx, id, longURL, userID, redirect)
+}
+
+func (s *faultyStorage) Get(ctx context.Context, id string) (storage.Link, error) {
+	if err := s.err(); err != nil {
+		return storage.Link{}, err
+	}
+	return s.Storage.Get(ctx, id)
+}
+
+func (s *faultyStorage) StoreBatch(ctx context.Context, pairs []database.RequestData) ([]storage.BatchResult, error) {
+	if err := s.err(); err != nil {
+		return nil, err
+	}
+	return s.Storage.StoreBatch(ctx, pairs)
+}
+
+func (s *faultyStorage) GetURLsByUser(ctx context.Context, userID string) ([]database.URLResponse, error) {
+	if err := s.err(); err != nil {
+		return nil, err
+	}
+	return s.Storage.GetURLsByUser(ctx, userID)
+}
+
+func (s *faultyStorage) Ping(ctx context.Context) error {
+	if err := s.err(); err != nil {
+		return err
+	}
+	return s.Storage.Ping(ctx)
+}
+
+func TestStorageFaults(t *testing.T) {
+	s := &faultyStorage{Storage: storage.NewMemory()}
+	core, logs := observer.New(zap.ErrorLevel)
+	sh := NewShortList(s, nil, zap.New(core))
+
+	e := echo.New()
+	e.Use(jwt.JWTMiddleware())
+	e.POST("/", sh.CreateShortURL)
+	e.GET("/:id", sh.GetLongURL)
+	e.GET("/ping", sh.PingDB)
+	e.POST("/api/shorten", sh.APIReturnShortURL)
+	e.POST("/api/shorten/batch", sh.APIPutMassiveData)
+	e.GET("/api/user/urls", sh.APIReturnUserData)
+
+	server := httptest.NewServer(e)
+	defer server.Close()
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	do := func(method, path, body string) int {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	requests := []struct {
+		method, path, body string
+	}{
+		{http.MethodPost, "/", "https://fault.example"},
+		{http.MethodPost, "/api/shorten", `{"url":"https://fault.example"}`},
+		{http.MethodPost, "/api/shorten/batch", `[{"correlation_id":"f1","original_url":"https://fault.example"}]`},
+		{http.MethodGet, "/abc123", ""},
+		{http.MethodGet, "/ping", ""},
+		{http.MethodGet, "/api/user/urls", ""},
+	}
+
+	// Сбой хранилища превращается в ответ 5xx, а не в остановку сервера
+	s.setFault(errors.New("connection reset by peer"))
+	for _, r := range requests {
+		assert.Equal(t, http.StatusInternalServerError, do(r.method, r.path, r.body), r.path)
+	}
+	assert.Equal(t, len(requests), logs.Len(), "every failure must be logged")
+
+	// Истекший таймаут означает, что хранилище недоступно
+	s.setFault(fmt.Errorf("query: %w", context.DeadlineExceeded))
+	assert.Equal(t, http.StatusServiceUnavailable, do(http.MethodPost, "/", "https://fault.example"))
+
+	// После сбоя сервер продолжает обслуживать запросы
+	s.setFault(nil)
+	assert.Equal(t, http.StatusCreated, do(http.MethodPost, "/", "https://fault.example"))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/ping", ""))
+}
+
+// blockingStorage держит запрос, пока не отменят его контекст, и сообщает
+// причину отмены
+type blockingStorage struct {
+	storage.Storage
+	entered chan struct{}
+	done    chan error
+}
+
+func (s *blockingStorage) wait(ctx context.Context) error {
+	s.entered <- struct{}{}
+	<-ctx.Done()
+	s.done <- ctx.Err()
+	return ctx.Err()
+}
+
+func (s *blockingStorage) Store(ctx context.Context, _, _, _ string, _ int) (string, error) {
+	return "", s.wait(ctx)
+}
+
+func (s *blockingStorage) Get(ctx context.Context, _ string) (storage.Link, error) {
+	return storage.Link{}, s.wait(ctx)
+}
+
+func (s *blockingStorage) StoreBatch(ctx context.Context, _ []database.RequestData) ([]storage.BatchResult, error) {
+	return nil, s.wait(ctx)
+}
+
+func (s *blockingStorage) GetURLsByUser(ctx context.Context, _ string) ([]database.URLResponse, error) {
+	return nil, s.wait(ctx)
+}
+
+func TestClientDisconnectCancelsStorage(t *testing.T) {
+	s := &blockingStorage{
+		Storage: storage.NewMemory(),
+		entered: make(chan struct{}),
+		done:    make(chan error, 1),
+	}
+	sh := NewShortList(s, nil, zap.NewNop())
+
+	e := echo.New()
+	e.Use(jwt.JWTMiddleware())
+	e.POST("/", sh.CreateShortURL)
+	e.GET("/:id", sh.GetLongURL)
+	e.POST("/api/shorten/batch", sh.APIPutMassiveData)
+	e.GET("/api/user/urls", sh.APIReturnUserData)
+
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	requests := []struct {
+		method, path, body string
+	}{
+		{http.MethodPost, "/", "https://cancel.example"},
+		{http.MethodGet, "/abc123", ""},
+		{http.MethodPost, "/api/shorten/batch", `[{"correlation_id":"c1","original_url":"https://cancel.example"}]`},
+		{http.MethodGet, "/api/user/urls", ""},
+	}
+
+	for _, r := range requests {
+		t.Run(r.path, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			req, err := http.NewRequestWithContext(ctx, r.method, server.URL+r.path, strings.NewReader(r.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			go func() {
+				// Клиент уходит, пока запрос к хранилищу еще выполняется
+				<-s.entered
+				cancel()
+			}()
+			_, err = http.DefaultClient.Do(req)
+			assert.ErrorIs(t, err, context.Canceled)
+
+			select {
+			case err := <-s.done:
+				assert.ErrorIs(t, err, context.Canceled)
+			case <-time.After(5 * time.Second):
+				t.Fatal("storage call was not cancelled")
+			}
+		})
+	}
+}
+
+func TestDeleteAndRestoreUserURLs(t *testing.T) {
+	s := storage.NewMemory()
+	q, err := deletion.New(s, "", deletion.Options{FlushInterval: 10 * time.Millisecond}, zap.NewNop())
+	require.NoError(t, err)
+	defer q.Close(context.Background())
+
+	e := echo.New()
+	e.Use(jwt.JWTMiddleware())
+	sh := NewShortList(s, q, zap.NewNop())
+	e.POST("/", sh.CreateShortURL)
+	e.GET("/:id", sh.GetLongURL)
+	e.GET("/api/user/urls", sh.APIReturnUserData)
+	e.DELETE("/api/user/urls", sh.APIDeleteUserURLs)
+	e.GET("/api/user/urls/delete/:job", sh.APIDeleteStatus)
+	e.GET("/api/user/urls/trash", sh.APIReturnUserTrash)
+	e.POST("/api/user/urls/restore", sh.APIRestoreUserURLs)
+
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	client := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	do := func(method, path, body string) (int, string) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	status, body := do(http.MethodPost, "/", "https://delete.example")
+	require.Equal(t, http.StatusCreated, status)
+	id := body[strings.LastIndex(body, "/")+1:]
+
+	// Удаление возвращает задание, за которым можно следить
+	status, body = do(http.MethodDelete, "/api/user/urls", fmt.Sprintf(`["%s"]`, id))
+	require.Equal(t, http.StatusAccepted, status)
+	var job deletion.Job
+	require.NoError(t, json.Unmarshal([]byte(body), &job))
+	assert.NotEmpty(t, job.ID)
+	assert.Equal(t, 1, job.Total)
+
+	require.Eventually(t, func() bool {
+		status, body = do(http.MethodGet, "/api/user/urls/delete/"+job.ID, "")
+		require.Equal(t, http.StatusOK, status)
+		require.NoError(t, json.Unmarshal([]byte(body), &job))
+		return job.Status == deletion.StatusDone
+	}, 2*time.Second, 10*time.Millisecond)
+
+	status, _ = do(http.MethodGet, "/"+id, "")
+	assert.Equal(t, http.StatusGone, status)
+
+	// Удаленные ссылки попадают в список пользователя только по запросу
+	status, _ = do(http.MethodGet, "/api/user/urls", "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, body = do(http.MethodGet, "/api/user/urls?deleted=true", "")
+	require.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, fmt.Sprintf(`[{"short_url":"http://localhost:8080/%s","original_url":"https://delete.example","is_deleted":true}]`, id), body)
+	status, _ = do(http.MethodGet, "/api/user/urls?deleted=maybe", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// Чужие и неизвестные задания не видны
+	status, _ = do(http.MethodGet, "/api/user/urls/delete/unknown", "")
+	assert.Equal(t, http.StatusNotFound, status)
+	resp, err := http.Get(server.URL + "/api/user/urls/delete/" + job.ID)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Удаленная ссылка видна в корзине и восстанавливается
+	status, body = do(http.MethodGet, "/api/user/urls/trash", "")
+	require.Equal(t, http.StatusOK, status)
+	var trash []TrashResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &trash))
+	require.Len(t, trash, 1)
+	assert.True(t, strings.HasSuffix(trash[0].ShortURL, "/"+id))
+	assert.Equal(t, "https://delete.example", trash[0].OriginalURL)
+
+	status, body = do(http.MethodPost, "/api/user/urls/restore", fmt.Sprintf(`["%s", "unknown"]`, id))
+	require.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, fmt.Sprintf(`["%s"]`, id), body)
+
+	status, _ = do(http.MethodGet, "/"+id, "")
+	assert.Equal(t, http.StatusTemporaryRedirect, status)
+	status, _ = do(http.MethodGet, "/api/user/urls/trash", "")
+	assert.Equal(t, http.StatusNoContent, status)
+}
+
+func TestAliases(t *testing.T) {
+	s := storage.NewMemory()
+	sh := NewShortList(s, nil, zap.NewNop())
+	sh.Reserve("/stats/:id")
+	sh.Reserve("/:id")
+
+	e := echo.New()
+	e.Use(jwt.JWTMiddleware())
+	e.GET("/:id", sh.GetLongURL)
+	e.POST("/api/shorten", sh.APIReturnShortURL)
+	e.POST("/api/shorten/batch", sh.APIPutMassiveData)
+
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	client := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	do := func(client *http.Client, method, path, body string) (int, string) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	status, body := do(client, http.MethodPost, "/api/shorten", `{"url":"https://sale.example","alias":"spring-sale"}`)
+	require.Equal(t, http.StatusCreated, status)
+	var short ShortResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &short))
+	assert.Equal(t, "http://localhost:8080/spring-sale", short.Result)
+
+	status, _ = do(client, http.MethodGet, "/spring-sale", "")
+	assert.Equal(t, http.StatusTemporaryRedirect, status)
+
+	// Занятый псевдоним не перезаписывается другим пользователем
+	other := &http.Client{}
+	status, _ = do(other, http.MethodPost, "/api/shorten", `{"url":"https://other.example","alias":"spring-sale"}`)
+	assert.Equal(t, http.StatusConflict, status)
+	got, err := s.Get(context.Background(), "spring-sale")
+	require.NoError(t, err)
+	assert.Equal(t, "https://sale.example", got.OriginalURL)
+
+	// Недопустимые и зарезервированные псевдонимы отклоняются
+	for _, alias := range []string{"ab", strings.Repeat("a", MaxAliasLength+1), "spring sale", "sale/1", "ping", "API", "stats"} {
+		status, _ = do(client, http.MethodPost, "/api/shorten", fmt.Sprintf(`{"url":"https://bad.example","alias":%q}`, alias))
+		assert.Equal(t, http.StatusBadRequest, status, alias)
+	}
+
+	// В пакете псевдоним заменяет correlation_id, занятый отмечается конфликтом
+	status, body = do(client, http.MethodPost, "/api/shorten/batch", `[
+		{"correlation_id":"1","original_url":"https://batch.example/1","alias":"summer_sale"},
+		{"correlation_id":"2","original_url":"https://batch.example/2","alias":"spring-sale"}
+	]`)
+	require.Equal(t, http.StatusCreated, status)
+	var batch []LongResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &batch))
+	require.Len(t, batch, 2)
+	assert.Equal(t, LongResponse{ID: "1", ShortURL: "http://localhost:8080/summer_sale"}, batch[0])
+	assert.Equal(t, LongResponse{ID: "2", Conflict: true}, batch[1])
+
+	status, _ = do(client, http.MethodPost, "/api/shorten/batch", `[{"correlation_id":"3","original_url":"https://batch.example/3","alias":"debug"}]`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// Без псевдонима correlation_id становится идентификатором: он не должен
+	// занимать маршрут или ломать путь
+	for _, id := range []string{"", "ping", "stats", "sale/1"} {
+		status, _ = do(client, http.MethodPost, "/api/shorten/batch", fmt.Sprintf(`[{"correlation_id":%q,"original_url":"https://batch.example/4"}]`, id))
+		assert.Equal(t, http.StatusBadRequest, status, id)
+	}
+	_, err = s.Get(context.Background(), "ping")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// Длина и запрещённые слова проверяются только у псевдонимов: короткие
+	// ключи и UUID, в которых фильтр находит слово, принимаются
+	sh.Filter = idgen.NewFilter([]string{"fag"})
+	uuid := "39bdfa92-1b7d-d15d-a1bf-0263e40908d4"
+	require.True(t, sh.Filter.Blocked(uuid))
+	status, _ = do(client, http.MethodPost, "/api/shorten/batch", fmt.Sprintf(`[
+		{"correlation_id":"1","original_url":"https://batch.example/5"},
+		{"correlation_id":%q,"original_url":"https://batch.example/6"}
+	]`, uuid))
+	assert.Equal(t, http.StatusCreated, status)
+	for _, id := range []string{"1", uuid} {
+		_, err = s.Get(context.Background(), id)
+		assert.NoError(t, err, id)
+	}
+
+	// Сгенерированный идентификатор не может совпасть с маршрутом
+	sh.IDs = fixedID("ping")
+	_, err = sh.StoreURL(context.Background(), "https://generated.example", "user", 0)
+	assert.Error(t, err)
+}
+
+func TestRedirects(t *testing.T) {
+	defer func(maxAge time.Duration) { config.Options.RedirectMaxAge = maxAge }(config.Options.RedirectMaxAge)
+	config.Options.RedirectMaxAge = time.Hour
+
+	s := storage.NewMemory()
+	sh := NewShortList(s, nil, zap.NewNop())
+
+	e := echo.New()
+	e.Use(jwt.JWTMiddleware())
+	e.GET("/:id", sh.GetLongURL)
+	e.POST("/api/shorten", sh.APIReturnShortURL)
+	e.PATCH("/api/user/urls/:id", sh.APIUpdateUserURL)
+
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	client := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	do := func(client *http.Client, method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	// По умолчанию ссылка временная и не кешируется клиентом
+	resp := do(client, http.MethodPost, "/api/shorten", `{"url":"https://default.example","alias":"default"}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp = do(client, http.MethodGet, "/default", "")
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "private, no-cache", resp.Header.Get("Cache-Control"))
+
+	// Постоянная ссылка кешируется на настроенное время
+	resp = do(client, http.MethodPost, "/api/shorten", `{"url":"https://moved.example","alias":"moved","redirect":308}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp = do(client, http.MethodGet, "/moved", "")
+	assert.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+	assert.Equal(t, "https://moved.example", resp.Header.Get("Location"))
+	assert.Equal(t, "public, max-age=3600", resp.Header.Get("Cache-Control"))
+
+	// Владелец меняет тип перенаправления
+	resp = do(client, http.MethodPatch, "/api/user/urls/moved", `{"redirect":302}`)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = do(client, http.MethodGet, "/moved", "")
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "private, no-cache", resp.Header.Get("Cache-Control"))
+
+	// Недопустимые коды и пустые изменения отклоняются
+	resp = do(client, http.MethodPost, "/api/shorten", `{"url":"https://bad.example","redirect":200}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	for _, body := range []string{`{"redirect":303}`, `{}`} {
+		resp = do(client, http.MethodPatch, "/api/user/urls/moved", body)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+	}
+
+	// Чужую ссылку изменить нельзя
+	resp = do(&http.Client{}, http.MethodPatch, "/api/user/urls/moved", `{"redirect":301}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	got, err := s.Get(context.Background(), "moved")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusFound, got.Redirect)
+}
+
+// attemptIDs предлагает идентификатор по номеру попытки
+type attemptIDs []string
+
+func (ids attemptIDs) Generate(_, _ string, attempt int) string {
+	return ids[attempt]
+}
+
+func TestBlockedIDs(t *testing.T) {
+	ctx := context.Background()
+	sh := NewShortList(storage.NewMemory(), nil, zap.NewNop())
+	sh.Filter = idgen.NewFilter([]string{"bad"})
+
+	// Идентификатор с запрещенным словом пропускается, как занятый
+	sh.IDs = attemptIDs{"xB4dx", "good12"}
+	shortURL, err := sh.StoreURL(ctx, "https://blocked.example", "user", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/good12", shortURL)
+
+	// Те же проверки действуют для псевдонимов
+	assert.Error(t, sh.validateAlias("so-b-a-d"))
+	assert.NoError(t, sh.validateAlias("so-good"))
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/vkobazev/goShortenerUrl/internal/config"
+)
+
+var errRedirect = errors.New("redirect must be 301, 302, 307 or 308, or 0 for the default")
+
+// validateRedirect checks a redirect status requested for a link; 0 keeps
+// the server default.
+func validateRedirect(code int) error {
+	if code != 0 && !config.ValidRedirect(code) {
+		return errRedirect
+	}
+	return nil
+}
+
+// redirectStatus returns the status a link with redirect responds with.
+func redirectStatus(redirect int) int {
+	if redirect == 0 {
+		redirect = config.Options.Redirect
+	}
+	if redirect == 0 {
+		return http.StatusTemporaryRedirect
+	}
+	return redirect
+}
+
+// redirectCacheControl returns the Cache-Control header of a redirect with
+// status. Clients keep permanent redirects for the configured time, so a
+// later change of the link reaches them eventually; temporary redirects
+// must not be cached, so every visit reaches the server.
+func redirectCacheControl(status int) string {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+		return "public, max-age=" + strconv.Itoa(int(config.Options.RedirectMaxAge.Seconds()))
+	default:
+		return "private, no-cache"
+	}
+}
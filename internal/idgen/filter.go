@@ -0,0 +1,144 @@
+package idgen
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Confusable are characters easily mistaken for one another when an ID is
+// read aloud or typed from print: 0 and O, 1, I and l, o.
+const Confusable = "01IOilo"
+
+// Unambiguous returns alphabet without its Confusable characters.
+func Unambiguous(alphabet string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(Confusable, r) {
+			return -1
+		}
+		return r
+	}, alphabet)
+}
+
+//go:embed blocklist.txt
+var defaultBlocklist []byte
+
+// Filter rejects IDs that contain a blocked word, even when it is spelled
+// with lookalike digits, mixed case or separators. Allowed words are
+// exceptions: a blocked word inside one of them does not count.
+type Filter struct {
+	words   []string // folded
+	allowed []string // folded
+}
+
+// NewFilter blocks words. A word starting with ! is allowed instead, like
+// "!cocktail" next to "cock". Empty words are ignored.
+func NewFilter(words []string) *Filter {
+	f := &Filter{}
+	for _, w := range words {
+		list := &f.words
+		if strings.HasPrefix(w, "!") {
+			w, list = w[1:], &f.allowed
+		}
+		if w = fold(w); w != "" {
+			*list = append(*list, w)
+		}
+	}
+	return f
+}
+
+// LoadFilter reads a blocklist file of one word per line; blank lines and
+// lines starting with # are skipped, lines starting with ! are allowed
+// words. An empty fileName loads the built-in list.
+func LoadFilter(fileName string) (*Filter, error) {
+	if fileName == "" {
+		return readFilter(bytes.NewReader(defaultBlocklist))
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("opening blocklist: %w", err)
+	}
+	defer file.Close()
+
+	f, err := readFilter(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading blocklist %s: %w", fileName, err)
+	}
+	return f, nil
+}
+
+func readFilter(r io.Reader) (*Filter, error) {
+	var words []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewFilter(words), nil
+}
+
+// Blocked reports whether id contains a blocked word. A nil Filter blocks
+// nothing.
+func (f *Filter) Blocked(id string) bool {
+	if f == nil {
+		return false
+	}
+	folded := fold(id)
+	// Folded words hold no spaces, so masking allowed words with one keeps
+	// them from matching
+	for _, w := range f.allowed {
+		folded = strings.ReplaceAll(folded, w, " ")
+	}
+	for _, w := range f.words {
+		if strings.Contains(folded, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// fold lower-cases s, replaces digits by the letters they resemble and
+// drops separators, so that variants of a word compare equal.
+func fold(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', '_', '.', '~', ' ':
+			return -1
+		case '0':
+			return 'o'
+		case '1':
+			return 'i'
+		case '3':
+			return 'e'
+		case '4':
+			return 'a'
+		case '5':
+			return 's'
+		case '7':
+			return 't'
+		case '8':
+			return 'b'
+		case '9':
+			return 'g'
+		}
+		if 'A' <= r && r <= 'Z' {
+			r += 'a' - 'A'
+		}
+		// l reads as 1 and I
+		if r == 'l' {
+			return 'i'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,77 @@
+package idgen
+
+import (
+	"math"
+	"sync"
+)
+
+// Recorder is implemented by generators that need to know how many links
+// are stored.
+type Recorder interface {
+	// Stored is called after n new links are stored.
+	Stored(n int)
+}
+
+// Growing makes IDs with a fixed-length generator and switches to a longer
+// one once the stored links take more than threshold of the IDs of the
+// current length. A random ID is then taken with a probability of at most
+// threshold, so retries stay rare however many links there are.
+type Growing struct {
+	fixed     func(length int) IDGenerator
+	base      float64
+	threshold float64
+
+	mu     sync.RWMutex
+	stored uint64
+	length int
+	gen    IDGenerator
+}
+
+// NewGrowing starts at length, or longer if stored links already take
+// more than threshold of its IDs. fixed makes a generator of IDs of a
+// given length from an alphabet of alphabetSize characters.
+func NewGrowing(fixed func(length int) IDGenerator, alphabetSize, length int, threshold float64, stored uint64) *Growing {
+	g := &Growing{
+		fixed:     fixed,
+		base:      float64(alphabetSize),
+		threshold: threshold,
+		stored:    stored,
+		length:    length,
+	}
+	g.grow()
+	g.gen = fixed(g.length)
+	return g
+}
+
+func (g *Growing) Generate(longURL, userID string, attempt int) string {
+	g.mu.RLock()
+	gen := g.gen
+	g.mu.RUnlock()
+	return gen.Generate(longURL, userID, attempt)
+}
+
+func (g *Growing) Stored(n int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.stored += uint64(n)
+	if length := g.length; g.grow() != length {
+		g.gen = g.fixed(g.length)
+	}
+}
+
+// Length returns the length of the IDs made now.
+func (g *Growing) Length() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.length
+}
+
+// grow lengthens IDs until the stored links fit under the threshold and
+// returns the new length.
+func (g *Growing) grow() int {
+	for float64(g.stored) > g.threshold*math.Pow(g.base, float64(g.length)) {
+		g.length++
+	}
+	return g.length
+}
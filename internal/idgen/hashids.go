@@ -0,0 +1,112 @@
+package idgen
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// Hashids makes IDs from a counter like Counter, but hides the order: the
+// alphabet is shuffled with a salt, and each ID starts with a lottery
+// character that keys a reshuffle before every following digit. The scheme
+// follows hashids (https://hashids.org) without separators and guards, as
+// IDs always hold a single number. Decode recovers the number.
+type Hashids struct {
+	alphabet  string // shuffled with the salt
+	salt      string
+	minLength int
+	next      atomic.Uint64
+}
+
+// NewHashids makes IDs of characters from alphabet, at least minLength of
+// them, starting at number start.
+func NewHashids(alphabet, salt string, minLength int, start uint64) *Hashids {
+	h := &Hashids{
+		alphabet:  shuffle(alphabet, salt),
+		salt:      salt,
+		minLength: minLength,
+	}
+	h.next.Store(start)
+	return h
+}
+
+func (h *Hashids) Generate(_, _ string, _ int) string {
+	return h.Encode(h.next.Add(1) - 1)
+}
+
+func (h *Hashids) Resume(id string) {
+	if n, ok := h.Decode(id); ok {
+		raise(&h.next, n)
+	}
+}
+
+// Encode returns the ID of n.
+func (h *Hashids) Encode(n uint64) string {
+	base := uint64(len(h.alphabet))
+	lottery := h.alphabet[n%base]
+
+	// Digits least significant first, padded with zeros so that the ID
+	// with its lottery character has the minimum length
+	var digits []uint64
+	for m := n; m > 0 || len(digits) == 0; m /= base {
+		digits = append(digits, m%base)
+	}
+	for len(digits) < h.minLength-1 {
+		digits = append(digits, 0)
+	}
+
+	id := make([]byte, 1, len(digits)+1)
+	id[0] = lottery
+	alphabet := h.alphabet
+	for i := len(digits) - 1; i >= 0; i-- {
+		alphabet = h.reshuffle(lottery, alphabet)
+		id = append(id, alphabet[digits[i]])
+	}
+	return string(id)
+}
+
+// Decode returns the number id was made from, or false if no number of
+// this generator makes id.
+func (h *Hashids) Decode(id string) (uint64, bool) {
+	if len(id) < 2 {
+		return 0, false
+	}
+	base := uint64(len(h.alphabet))
+
+	var n uint64
+	alphabet := h.alphabet
+	for i := 1; i < len(id); i++ {
+		alphabet = h.reshuffle(id[0], alphabet)
+		digit := strings.IndexByte(alphabet, id[i])
+		if digit < 0 || n > (^uint64(0)-uint64(digit))/base {
+			return 0, false
+		}
+		n = n*base + uint64(digit)
+	}
+	// Rejects a wrong lottery character and excess padding
+	if h.Encode(n) != id {
+		return 0, false
+	}
+	return n, true
+}
+
+// reshuffle returns the alphabet of the next digit of an ID with lottery.
+func (h *Hashids) reshuffle(lottery byte, alphabet string) string {
+	key := string(lottery) + h.salt + alphabet
+	return shuffle(alphabet, key[:len(alphabet)])
+}
+
+// shuffle reorders alphabet deterministically by key, as hashids does.
+func shuffle(alphabet, key string) string {
+	if key == "" {
+		return alphabet
+	}
+	b := []byte(alphabet)
+	for i, v, p := len(b)-1, 0, 0; i > 0; i-- {
+		v %= len(key)
+		p += int(key[v])
+		j := (int(key[v]) + v + p) % i
+		b[i], b[j] = b[j], b[i]
+		v++
+	}
+	return string(b)
+}
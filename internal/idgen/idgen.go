@@ -0,0 +1,273 @@
+// Package idgen makes short IDs for new links. Generators only propose
+// IDs: the storage refuses one that is taken, and the caller asks again
+// with the next attempt number.
+package idgen
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Alphabet is the default set of characters IDs are made of.
+const Alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// ValidateAlphabet checks that alphabet can make IDs: at least two distinct
+// characters, each allowed unescaped in a URL path.
+func ValidateAlphabet(alphabet string) error {
+	if len(alphabet) < 2 {
+		return fmt.Errorf("ID alphabet needs at least 2 characters, got %q", alphabet)
+	}
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) >= 0) {
+			return fmt.Errorf("ID alphabet may only contain letters, digits and -_.~, got %q", c)
+		}
+		if strings.IndexByte(alphabet[:i], c) >= 0 {
+			return fmt.Errorf("ID alphabet has %q twice", c)
+		}
+	}
+	return nil
+}
+
+// Strategy names a way of making IDs.
+type Strategy string
+
+const (
+	// StrategyRandom picks random characters from a cryptographic source.
+	StrategyRandom Strategy = "random"
+	// StrategyCounter encodes a counter, giving the shortest possible IDs.
+	StrategyCounter Strategy = "counter"
+	// StrategyHashids encodes a counter with a salted, shuffled alphabet,
+	// so consecutive IDs look unrelated but can still be decoded.
+	StrategyHashids Strategy = "hashids"
+	// StrategyHash derives the ID from the URL and its owner, so storing
+	// the same link again yields the same ID.
+	StrategyHash Strategy = "hash"
+)
+
+func ParseStrategy(s string) (Strategy, error) {
+	switch strategy := Strategy(s); strategy {
+	case StrategyRandom, StrategyCounter, StrategyHashids, StrategyHash:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown ID generator %q, want random, counter, hashids or hash", s)
+	}
+}
+
+// Options configures a generator made by New.
+type Options struct {
+	// Length is the length of random and hash IDs, and the minimum length
+	// of hashids IDs.
+	Length int
+	// Alphabet is the set of characters of IDs, Alphabet if empty.
+	Alphabet string
+	// Salt keys the hashids alphabet. IDs made with another salt decode to
+	// other numbers.
+	Salt string
+	// Start is the number of stored links. Counter based generators start
+	// there until Resume moves them past the IDs already stored, and
+	// growing ones count links from there.
+	Start uint64
+	// GrowAt makes random and hash IDs longer once the stored links take
+	// more than this share of the IDs of the current length; 0 keeps the
+	// length fixed. Counter based IDs grow by themselves.
+	GrowAt float64
+}
+
+// IDGenerator makes IDs for new links.
+type IDGenerator interface {
+	// Generate returns an ID for longURL of userID. attempt is 0 on the
+	// first call and grows by one each time the previous ID was taken.
+	Generate(longURL, userID string, attempt int) string
+}
+
+// Resumer is implemented by generators that encode a counter. After a
+// purge there are fewer links than numbers used, so the counter has to be
+// moved past every stored ID rather than start at the number of links.
+type Resumer interface {
+	// Resume makes the counter continue after the number id was made
+	// from, if it is not past it already. IDs this generator could not
+	// have made are ignored; an alias that happens to decode moves the
+	// counter as well, which makes later IDs longer but never taken.
+	Resume(id string)
+}
+
+// New returns a generator using strategy.
+func New(strategy Strategy, opts Options) (IDGenerator, error) {
+	if opts.Length <= 0 {
+		return nil, fmt.Errorf("ID length must be positive, got %d", opts.Length)
+	}
+	if opts.GrowAt < 0 || opts.GrowAt >= 1 {
+		return nil, fmt.Errorf("ID growth threshold must be in [0, 1), got %g", opts.GrowAt)
+	}
+	alphabet := opts.Alphabet
+	if alphabet == "" {
+		alphabet = Alphabet
+	}
+	if err := ValidateAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+
+	var fixed func(length int) IDGenerator
+	switch strategy {
+	case StrategyRandom:
+		fixed = func(length int) IDGenerator { return NewRandom(alphabet, length) }
+	case StrategyCounter:
+		return NewCounter(alphabet, opts.Start), nil
+	case StrategyHashids:
+		return NewHashids(alphabet, opts.Salt, opts.Length, opts.Start), nil
+	case StrategyHash:
+		fixed = func(length int) IDGenerator { return NewHash(alphabet, length) }
+	default:
+		return nil, fmt.Errorf("unknown ID generator %q", strategy)
+	}
+
+	if opts.GrowAt == 0 {
+		return fixed(opts.Length), nil
+	}
+	return NewGrowing(fixed, len(alphabet), opts.Length, opts.GrowAt, opts.Start), nil
+}
+
+// Random makes IDs of random characters. A taken ID is answered with a new
+// random one.
+type Random struct {
+	alphabet string
+	length   int
+}
+
+func NewRandom(alphabet string, length int) *Random {
+	return &Random{alphabet: alphabet, length: length}
+}
+
+func (r *Random) Generate(_, _ string, _ int) string {
+	max := big.NewInt(int64(len(r.alphabet)))
+	id := make([]byte, r.length)
+	for i := range id {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			// crypto/rand does not fail on supported platforms
+			panic(err)
+		}
+		id[i] = r.alphabet[n.Int64()]
+	}
+	return string(id)
+}
+
+// Counter makes IDs by encoding consecutive numbers. Every call takes the
+// next number, so a taken ID is answered with the one after it.
+type Counter struct {
+	alphabet string
+	next     atomic.Uint64
+}
+
+func NewCounter(alphabet string, start uint64) *Counter {
+	c := &Counter{alphabet: alphabet}
+	c.next.Store(start)
+	return c
+}
+
+func (c *Counter) Generate(_, _ string, _ int) string {
+	return encode(c.next.Add(1)-1, c.alphabet)
+}
+
+func (c *Counter) Resume(id string) {
+	if n, ok := decode(id, c.alphabet); ok {
+		raise(&c.next, n)
+	}
+}
+
+// Hash makes IDs from a SHA-256 of the URL and its owner. Retries mix the
+// attempt number in, so a collision moves to another ID.
+type Hash struct {
+	alphabet string
+	length   int
+	// perBlock is how many characters eight bytes of the hash give
+	perBlock int
+}
+
+func NewHash(alphabet string, length int) *Hash {
+	h := &Hash{alphabet: alphabet, length: length}
+	base := uint64(len(alphabet))
+	for max := ^uint64(0); max >= base; max /= base {
+		h.perBlock++
+	}
+	return h
+}
+
+func (h *Hash) Generate(longURL, userID string, attempt int) string {
+	hash := sha256.New()
+	hash.Write([]byte(userID))
+	hash.Write([]byte{0})
+	hash.Write([]byte(longURL))
+	if attempt > 0 {
+		hash.Write([]byte{0})
+		hash.Write([]byte(strconv.Itoa(attempt)))
+	}
+	sum := hash.Sum(nil)
+
+	// Eight bytes of the hash give perBlock characters, ten for the default
+	// alphabet; longer IDs take the next eight bytes and so on.
+	base := uint64(len(h.alphabet))
+	id := make([]byte, 0, h.length)
+	for i := 0; len(id) < h.length; i = (i + 8) % len(sum) {
+		n := binary.BigEndian.Uint64(sum[i : i+8])
+		for j := 0; j < h.perBlock && len(id) < h.length; j++ {
+			id = append(id, h.alphabet[n%base])
+			n /= base
+		}
+	}
+	return string(id)
+}
+
+// encode writes n in the base of alphabet, most significant digit first.
+func encode(n uint64, alphabet string) string {
+	base := uint64(len(alphabet))
+	if n == 0 {
+		return alphabet[:1]
+	}
+	var buf [64]byte
+	i := len(buf)
+	for n > 0 {
+		i--
+		buf[i] = alphabet[n%base]
+		n /= base
+	}
+	return string(buf[i:])
+}
+
+// decode is the inverse of encode. It rejects characters outside alphabet,
+// leading zero digits and numbers that overflow.
+func decode(id, alphabet string) (uint64, bool) {
+	if id == "" || len(id) > 1 && id[0] == alphabet[0] {
+		return 0, false
+	}
+	base := uint64(len(alphabet))
+	var n uint64
+	for i := 0; i < len(id); i++ {
+		digit := strings.IndexByte(alphabet, id[i])
+		if digit < 0 || n > (^uint64(0)-uint64(digit))/base {
+			return 0, false
+		}
+		n = n*base + uint64(digit)
+	}
+	return n, true
+}
+
+// raise moves next past n if it is not already.
+func raise(next *atomic.Uint64, n uint64) {
+	if n == ^uint64(0) {
+		return
+	}
+	for {
+		cur := next.Load()
+		if cur > n || next.CompareAndSwap(cur, n+1) {
+			return
+		}
+	}
+}
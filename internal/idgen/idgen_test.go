@@ -0,0 +1,208 @@
+package idgen_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vkobazev/goShortenerUrl/internal/idgen"
+)
+
+func TestGenerators(t *testing.T) {
+	for _, strategy := range []idgen.Strategy{
+		idgen.StrategyRandom,
+		idgen.StrategyCounter,
+		idgen.StrategyHashids,
+		idgen.StrategyHash,
+	} {
+		t.Run(string(strategy), func(t *testing.T) {
+			ids, err := idgen.New(strategy, idgen.Options{Length: 6, Salt: "salt"})
+			require.NoError(t, err)
+
+			seen := make(map[string]bool)
+			for i := 0; i < 1000; i++ {
+				// The hash generator needs different URLs to give different IDs
+				id := ids.Generate("https://example.com/"+strconv.Itoa(i), "user", 0)
+				assert.NotContains(t, seen, id)
+				seen[id] = true
+				for _, c := range id {
+					assert.Contains(t, idgen.Alphabet, string(c))
+				}
+				if strategy != idgen.StrategyCounter {
+					assert.GreaterOrEqual(t, len(id), 6)
+				}
+			}
+		})
+	}
+}
+
+func TestCounterStart(t *testing.T) {
+	c := idgen.NewCounter(idgen.Alphabet, 0)
+	assert.Equal(t, "a", c.Generate("", "", 0))
+	assert.Equal(t, "b", c.Generate("", "", 0))
+
+	// A restarted counter continues after the stored links
+	c = idgen.NewCounter(idgen.Alphabet, 62)
+	assert.Equal(t, "ba", c.Generate("", "", 0))
+}
+
+func TestResume(t *testing.T) {
+	// Purged links leave fewer links than IDs made, so the counter moves
+	// past the highest stored ID instead
+	c := idgen.NewCounter(idgen.Alphabet, 2)
+	c.Resume("bc")
+	c.Resume("z")
+	assert.Equal(t, "bd", c.Generate("", "", 0))
+
+	// Strings the counter cannot make are ignored
+	for _, id := range []string{"", "ab", "b-c", "9999999999999999"} {
+		c.Resume(id)
+	}
+	assert.Equal(t, "be", c.Generate("", "", 0))
+
+	h := idgen.NewHashids(idgen.Alphabet, "salt", 6, 0)
+	h.Resume(h.Encode(1000))
+	h.Resume("short")
+	assert.Equal(t, h.Encode(1001), h.Generate("", "", 0))
+}
+
+func TestHashidsRoundTrip(t *testing.T) {
+	h := idgen.NewHashids(idgen.Alphabet, "salt", 6, 0)
+	for _, n := range []uint64{0, 1, 61, 62, 1000, 1 << 40} {
+		id := h.Encode(n)
+		assert.GreaterOrEqual(t, len(id), 6)
+		got, ok := h.Decode(id)
+		assert.True(t, ok, id)
+		assert.Equal(t, n, got)
+	}
+
+	// Consecutive numbers do not give similar IDs
+	assert.NotEqual(t, h.Encode(1)[:5], h.Encode(2)[:5])
+
+	// Another salt gives other IDs that this generator does not accept
+	other := idgen.NewHashids(idgen.Alphabet, "pepper", 6, 0)
+	assert.NotEqual(t, h.Encode(7), other.Encode(7))
+	_, ok := h.Decode(other.Encode(7))
+	assert.False(t, ok)
+	_, ok = h.Decode("a")
+	assert.False(t, ok)
+	_, ok = h.Decode("ab-cd!")
+	assert.False(t, ok)
+}
+
+func TestHashDeterministic(t *testing.T) {
+	h := idgen.NewHash(idgen.Alphabet, 8)
+	id := h.Generate("https://example.com", "user", 0)
+	assert.Len(t, id, 8)
+	assert.Equal(t, id, h.Generate("https://example.com", "user", 0))
+
+	// Other owners and retries move to another ID
+	assert.NotEqual(t, id, h.Generate("https://example.com", "other", 0))
+	assert.NotEqual(t, id, h.Generate("https://example.com", "user", 1))
+
+	// IDs longer than one block of the hash are still full length
+	assert.Len(t, idgen.NewHash(idgen.Alphabet, 24).Generate("https://example.com", "user", 0), 24)
+}
+
+func TestParseStrategy(t *testing.T) {
+	s, err := idgen.ParseStrategy("hashids")
+	require.NoError(t, err)
+	assert.Equal(t, idgen.StrategyHashids, s)
+
+	_, err = idgen.ParseStrategy("uuid")
+	assert.Error(t, err)
+
+	_, err = idgen.New(idgen.StrategyRandom, idgen.Options{})
+	assert.Error(t, err)
+}
+
+func TestAlphabet(t *testing.T) {
+	for _, strategy := range []idgen.Strategy{idgen.StrategyRandom, idgen.StrategyCounter, idgen.StrategyHashids, idgen.StrategyHash} {
+		ids, err := idgen.New(strategy, idgen.Options{Length: 12, Alphabet: "01"})
+		require.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			assert.Regexp(t, "^[01]+$", ids.Generate("https://example.com/"+strconv.Itoa(i), "user", 0), strategy)
+		}
+	}
+
+	assert.NoError(t, idgen.ValidateAlphabet("abc-_.~"))
+	assert.Error(t, idgen.ValidateAlphabet("a"))
+	assert.Error(t, idgen.ValidateAlphabet("abca"))
+	assert.Error(t, idgen.ValidateAlphabet("ab/"))
+	_, err := idgen.New(idgen.StrategyRandom, idgen.Options{Length: 6, Alphabet: "a b"})
+	assert.Error(t, err)
+}
+
+func TestGrowing(t *testing.T) {
+	// 100 IDs of length 2, growing once more than 10 are taken
+	fixed := func(length int) idgen.IDGenerator {
+		return idgen.NewRandom("0123456789", length)
+	}
+	g := idgen.NewGrowing(fixed, 10, 2, 0.1, 0)
+	assert.Equal(t, 2, g.Length())
+	assert.Len(t, g.Generate("", "", 0), 2)
+
+	g.Stored(10)
+	assert.Equal(t, 2, g.Length())
+	g.Stored(1)
+	assert.Equal(t, 3, g.Length())
+	assert.Len(t, g.Generate("", "", 0), 3)
+
+	// Links stored before a restart count from the start
+	g = idgen.NewGrowing(fixed, 10, 2, 0.1, 5000)
+	assert.Equal(t, 5, g.Length())
+
+	ids, err := idgen.New(idgen.StrategyHash, idgen.Options{Length: 1, Alphabet: "01", GrowAt: 0.5, Start: 3})
+	require.NoError(t, err)
+	assert.Len(t, ids.Generate("https://example.com", "user", 0), 3)
+
+	_, err = idgen.New(idgen.StrategyRandom, idgen.Options{Length: 6, GrowAt: 1})
+	assert.Error(t, err)
+}
+
+func TestFilter(t *testing.T) {
+	f := idgen.NewFilter([]string{"Bad", "", "lol", "!badge", "!"})
+	for _, id := range []string{"xbadx", "xBADx", "b4d", "b-a-d", "1o1", "L0L", "badbadge"} {
+		assert.True(t, f.Blocked(id), id)
+	}
+	for _, id := range []string{"bda", "good", "b4", "badge", "B4dge"} {
+		assert.False(t, f.Blocked(id), id)
+	}
+
+	var none *idgen.Filter
+	assert.False(t, none.Blocked("bad"))
+
+	// The built-in list is used without a file
+	f, err := idgen.LoadFilter("")
+	require.NoError(t, err)
+	assert.True(t, f.Blocked("xSh1Tx"))
+	assert.False(t, f.Blocked("analytics"))
+	for _, id := range []string{"cocktail-week", "peacock", "Hancock", "dickens", "swank"} {
+		assert.False(t, f.Blocked(id), id)
+	}
+	// An allowed word does not hide a blocked one next to it
+	assert.True(t, f.Blocked("cock-cocktail"))
+	assert.True(t, f.Blocked("swankwank"))
+
+	fileName := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(fileName, []byte("# comment\n\n  spam  \n"), 0o644))
+	f, err = idgen.LoadFilter(fileName)
+	require.NoError(t, err)
+	assert.True(t, f.Blocked("5pam"))
+	assert.False(t, f.Blocked("comment"))
+
+	_, err = idgen.LoadFilter(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestUnambiguous(t *testing.T) {
+	alphabet := idgen.Unambiguous(idgen.Alphabet)
+	assert.Len(t, alphabet, len(idgen.Alphabet)-len(idgen.Confusable))
+	assert.NotContains(t, alphabet, "0")
+	assert.NotContains(t, alphabet, "l")
+	assert.NoError(t, idgen.ValidateAlphabet(alphabet))
+}
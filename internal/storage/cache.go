@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/vkobazev/goShortenerUrl/internal/database"
+)
+
+// CacheStats reports how well a Cached storage serves redirects.
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Size      int    `json:"size"`
+	Capacity  int    `json:"capacity"`
+}
+
+type cacheEntry struct {
+	id      string
+	link    Link
+	err     error // ErrNotFound or ErrDeleted
+	expires time.Time
+}
+
+// Cached is a read-through cache of Get results in front of another
+// storage. Deleted and missing links are cached too, so that repeated
+// requests for them do not reach the backend. Entries live for at most ttl
+// and the least recently used one is evicted once size entries are held.
+// Writes through the cache invalidate the IDs they touch; writes made by
+// other processes become visible once the entry expires.
+type Cached struct {
+	Storage
+
+	size int
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	lru   *list.List // front is the most recently used
+	items map[string]*list.Element
+	// gen changes on every invalidation, so a Get that raced with a write
+	// does not cache what it read before the write.
+	gen   uint64
+	stats CacheStats
+}
+
+func NewCached(s Storage, size int, ttl time.Duration) *Cached {
+	return &Cached{
+		Storage: s,
+		size:    size,
+		ttl:     ttl,
+		lru:     list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+func (c *Cached) Store(ctx context.Context, id, longURL, userID string, redirect int) (string, error) {
+	storedID, err := c.Storage.Store(ctx, id, longURL, userID, redirect)
+	if err == nil {
+		c.invalidate(storedID)
+	}
+	return storedID, err
+}
+
+func (c *Cached) Get(ctx context.Context, id string) (Link, error) {
+	c.mu.Lock()
+	if elem, ok := c.items[id]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if time.Now().Before(entry.expires) {
+			c.lru.MoveToFront(elem)
+			c.stats.Hits++
+			c.mu.Unlock()
+			return entry.link, entry.err
+		}
+		c.remove(elem)
+	}
+	c.stats.Misses++
+	gen := c.gen
+	c.mu.Unlock()
+
+	link, err := c.Storage.Get(ctx, id)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		err = ErrNotFound
+	case errors.Is(err, ErrDeleted):
+		err = ErrDeleted
+	case err != nil:
+		return Link{}, err
+	}
+
+	c.mu.Lock()
+	if gen == c.gen {
+		c.add(&cacheEntry{
+			id:      id,
+			link:    link,
+			err:     err,
+			expires: time.Now().Add(c.ttl),
+		})
+	}
+	c.mu.Unlock()
+	return link, err
+}
+
+func (c *Cached) StoreBatch(ctx context.Context, pairs []database.RequestData) ([]BatchResult, error) {
+	results, err := c.Storage.StoreBatch(ctx, pairs)
+	ids := make([]string, len(pairs))
+	for i, pair := range pairs {
+		ids[i] = pair.ID
+	}
+	c.invalidate(ids...)
+	return results, err
+}
+
+func (c *Cached) SetRedirect(ctx context.Context, userID, id string, redirect int) error {
+	err := c.Storage.SetRedirect(ctx, userID, id, redirect)
+	c.invalidate(id)
+	return err
+}
+
+func (c *Cached) DeleteURLs(ctx context.Context, userID string, ids []string) error {
+	err := c.Storage.DeleteURLs(ctx, userID, ids)
+	c.invalidate(ids...)
+	return err
+}
+
+func (c *Cached) Import(ctx context.Context, records []Record) error {
+	err := c.Storage.Import(ctx, records)
+	ids := make([]string, len(records))
+	for i, r := range records {
+		ids[i] = r.ShortURL
+	}
+	c.invalidate(ids...)
+	return err
+}
+
+func (c *Cached) RestoreURLs(ctx context.Context, userID string, ids []string, since time.Time) ([]string, error) {
+	restored, err := c.Storage.RestoreURLs(ctx, userID, ids, since)
+	c.invalidate(ids...)
+	return restored, err
+}
+
+func (c *Cached) Purge(ctx context.Context, before time.Time) (int, error) {
+	n, err := c.Storage.Purge(ctx, before)
+	if n > 0 {
+		// Purged links turn from deleted into missing; their IDs are not
+		// known here, so everything goes
+		c.mu.Lock()
+		c.gen++
+		c.lru.Init()
+		c.items = make(map[string]*list.Element)
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+// Stats returns the counters collected since the cache was created.
+func (c *Cached) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Size = c.lru.Len()
+	stats.Capacity = c.size
+	return stats
+}
+
+// invalidate drops ids from the cache. It is called after the write, even a
+// failed one, since the write may have partly succeeded.
+func (c *Cached) invalidate(ids ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	for _, id := range ids {
+		if elem, ok := c.items[id]; ok {
+			c.remove(elem)
+		}
+	}
+}
+
+func (c *Cached) add(entry *cacheEntry) {
+	if elem, ok := c.items[entry.id]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.items[entry.id] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *Cached) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.items, elem.Value.(*cacheEntry).id)
+}
@@ -0,0 +1,123 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vkobazev/goShortenerUrl/internal/database"
+	"github.com/vkobazev/goShortenerUrl/internal/storage"
+	"github.com/vkobazev/goShortenerUrl/internal/storage/storagetest"
+)
+
+// countingStorage counts the lookups that reach the backend.
+type countingStorage struct {
+	storage.Storage
+	gets int
+}
+
+func (s *countingStorage) Get(ctx context.Context, id string) (storage.Link, error) {
+	s.gets++
+	return s.Storage.Get(ctx, id)
+}
+
+func TestCached(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return storage.NewCached(storage.NewMemory(), 1000, time.Minute)
+	})
+}
+
+func TestCachedReadThrough(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingStorage{Storage: storage.NewMemory()}
+	c := storage.NewCached(backend, 10, time.Minute)
+
+	_, err := c.Store(ctx, "abc", "https://a.example", "u1", 0)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		got, err := c.Get(ctx, "abc")
+		require.NoError(t, err)
+		assert.Equal(t, "https://a.example", got.OriginalURL)
+	}
+	assert.Equal(t, 1, backend.gets)
+
+	// Missing links are cached until something is stored under their ID
+	for i := 0; i < 2; i++ {
+		_, err = c.Get(ctx, "new")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	}
+	assert.Equal(t, 2, backend.gets)
+
+	_, err = c.Store(ctx, "new", "https://b.example", "u1", 0)
+	require.NoError(t, err)
+	got, err := c.Get(ctx, "new")
+	require.NoError(t, err)
+	assert.Equal(t, "https://b.example", got.OriginalURL)
+	assert.Equal(t, 3, backend.gets)
+
+	// Deleting invalidates, and the deleted state is cached in turn
+	require.NoError(t, c.DeleteURLs(ctx, "u1", []string{"abc"}))
+	for i := 0; i < 2; i++ {
+		_, err := c.Get(ctx, "abc")
+		assert.ErrorIs(t, err, storage.ErrDeleted)
+	}
+	assert.Equal(t, 4, backend.gets)
+
+	// Purged links are dropped from the cache as well
+	_, err = c.Purge(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	_, err = c.Get(ctx, "abc")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.Equal(t, 5, backend.gets)
+
+	// Batches invalidate the IDs they store as well
+	_, err = c.Get(ctx, "batch")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = c.StoreBatch(ctx, []database.RequestData{{ID: "batch", URL: "https://c.example", UserID: "u2"}})
+	require.NoError(t, err)
+	got, err = c.Get(ctx, "batch")
+	require.NoError(t, err)
+	assert.Equal(t, "https://c.example", got.OriginalURL)
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(7), stats.Misses)
+	assert.Equal(t, uint64(4), stats.Hits)
+	assert.Equal(t, 2, stats.Size)
+	assert.Equal(t, 10, stats.Capacity)
+}
+
+func TestCachedEviction(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingStorage{Storage: storage.NewMemory()}
+	c := storage.NewCached(backend, 2, time.Minute)
+
+	for _, id := range []string{"a", "b", "a", "c"} {
+		_, _ = c.Get(ctx, id)
+	}
+	// "b" was the least recently used when "c" came in
+	_, _ = c.Get(ctx, "a")
+	_, _ = c.Get(ctx, "b")
+
+	stats := c.Stats()
+	assert.Equal(t, 4, backend.gets)
+	assert.Equal(t, uint64(2), stats.Evictions)
+	assert.Equal(t, 2, stats.Size)
+}
+
+func TestCachedExpiry(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingStorage{Storage: storage.NewMemory()}
+	c := storage.NewCached(backend, 10, 20*time.Millisecond)
+
+	_, _ = c.Get(ctx, "a")
+	_, _ = c.Get(ctx, "a")
+	assert.Equal(t, 1, backend.gets)
+
+	time.Sleep(30 * time.Millisecond)
+	_, _ = c.Get(ctx, "a")
+	assert.Equal(t, 2, backend.gets)
+}
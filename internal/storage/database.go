@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/vkobazev/goShortenerUrl/internal/database"
+	"golang.org/x/sync/singleflight"
+)
+
+// URLDB is the query set shared by the SQL backends in package database.
+type URLDB interface {
+	// InsertURL stores the link unless userID already has longURL, which
+	// returns the existing ID with database.ErrConflict, or shortURL is
+	// taken, which returns database.ErrIDTaken. Check and insert are
+	// atomic.
+	InsertURL(ctx context.Context, shortURL, longURL, userID string, redirect int) (string, error)
+	InsertURLs(ctx context.Context, urlPairs []database.RequestData) ([]database.BatchResult, error)
+	// GetLink returns the link and deleted flag of shortURL, or
+	// database.ErrNotFound.
+	GetLink(ctx context.Context, shortURL string) (database.Link, bool, error)
+	SetRedirect(ctx context.Context, userID, shortURL string, redirect int) error
+	GetURLsByUser(ctx context.Context, userID string) ([]database.URLResponse, error)
+	DeleteURLforUser(ctx context.Context, userID string, shortURLs []string) error
+	GetDeletedURLsByUser(ctx context.Context, userID string, since time.Time) ([]database.DeletedURL, error)
+	RestoreURLs(ctx context.Context, userID string, shortURLs []string, since time.Time) ([]string, error)
+	CountURLs(ctx context.Context) (int64, error)
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	ExportURLs(ctx context.Context, fn func(database.URLRecord) error) error
+	ImportURLs(ctx context.Context, records []database.URLRecord) error
+	Ping(ctx context.Context) error
+	Close()
+}
+
+// Database stores links in an SQL database: PostgreSQL (database.DB) or
+// SQLite (database.SQLite).
+type Database struct {
+	db      URLDB
+	lookups singleflight.Group
+}
+
+type lookup struct {
+	link    Link
+	deleted bool
+}
+
+func NewDatabase(db URLDB) *Database {
+	return &Database{db: db}
+}
+
+func (d *Database) Store(ctx context.Context, id, longURL, userID string, redirect int) (string, error) {
+	return d.db.InsertURL(ctx, id, longURL, userID, redirect)
+}
+
+// Get looks id up with a single query. Concurrent lookups of the same id
+// share one query, so a link that suddenly gets popular costs the database
+// one round-trip per burst instead of one per request.
+func (d *Database) Get(ctx context.Context, id string) (Link, error) {
+	ch := d.lookups.DoChan(id, func() (any, error) {
+		// The query is shared, so it must not be cancelled with the
+		// request that happened to start it.
+		link, deleted, err := d.db.GetLink(context.WithoutCancel(ctx), id)
+		return lookup{link, deleted}, err
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return Link{}, res.Err
+		}
+		l := res.Val.(lookup)
+		if l.deleted {
+			return Link{}, ErrDeleted
+		}
+		return l.link, nil
+	case <-ctx.Done():
+		return Link{}, ctx.Err()
+	}
+}
+
+func (d *Database) SetRedirect(ctx context.Context, userID, id string, redirect int) error {
+	return d.db.SetRedirect(ctx, userID, id, redirect)
+}
+
+func (d *Database) StoreBatch(ctx context.Context, pairs []database.RequestData) ([]BatchResult, error) {
+	return d.db.InsertURLs(ctx, pairs)
+}
+
+func (d *Database) GetURLsByUser(ctx context.Context, userID string) ([]database.URLResponse, error) {
+	return d.db.GetURLsByUser(ctx, userID)
+}
+
+func (d *Database) DeleteURLs(ctx context.Context, userID string, ids []string) error {
+	return d.db.DeleteURLforUser(ctx, userID, ids)
+}
+
+func (d *Database) GetDeletedURLsByUser(ctx context.Context, userID string, since time.Time) ([]database.DeletedURL, error) {
+	return d.db.GetDeletedURLsByUser(ctx, userID, since)
+}
+
+func (d *Database) RestoreURLs(ctx context.Context, userID string, ids []string, since time.Time) ([]string, error) {
+	return d.db.RestoreURLs(ctx, userID, ids, since)
+}
+
+func (d *Database) Count(ctx context.Context) (int, error) {
+	n, err := d.db.CountURLs(ctx)
+	return int(n), err
+}
+
+func (d *Database) Purge(ctx context.Context, before time.Time) (int, error) {
+	n, err := d.db.PurgeDeleted(ctx, before)
+	return int(n), err
+}
+
+func (d *Database) Export(ctx context.Context, fn func(Record) error) error {
+	return d.db.ExportURLs(ctx, fn)
+}
+
+func (d *Database) Import(ctx context.Context, records []Record) error {
+	return d.db.ImportURLs(ctx, records)
+}
+
+func (d *Database) Ping(ctx context.Context) error {
+	return d.db.Ping(ctx)
+}
+
+func (d *Database) Close() error {
+	d.db.Close()
+	return nil
+}
@@ -0,0 +1,28 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vkobazev/goShortenerUrl/internal/database"
+	"github.com/vkobazev/goShortenerUrl/internal/storage"
+	"github.com/vkobazev/goShortenerUrl/internal/storage/storagetest"
+)
+
+// TestDatabase needs a running PostgreSQL, e.g. started with `make init_db`,
+// and its connection string in TEST_DATABASE_DSN.
+func TestDatabase(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	storagetest.RunPersistent(t, func(t *testing.T) storage.Storage {
+		db, err := database.New(dsn)
+		require.NoError(t, err)
+		require.NoError(t, db.MigrateUp(context.Background()))
+		return storage.NewDatabase(db)
+	})
+}
@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vkobazev/goShortenerUrl/internal/data"
+	"github.com/vkobazev/goShortenerUrl/internal/database"
+)
+
+// File keeps links in memory and appends every change to an event file.
+// Loading the latest snapshot and replaying the file on startup restores
+// links, their owners and deletions.
+type File struct {
+	*Memory
+	fileName string
+
+	mu       sync.Mutex // serializes changes and their writes to producer
+	producer *data.Producer
+	opts     data.Options
+
+	done    chan struct{} // closed to stop CompactEvery
+	stopped chan struct{}
+}
+
+func NewFile(fileName string, opts data.Options) (*File, error) {
+	m := NewMemory()
+
+	// Restore data from the snapshot and the events written after it
+	if err := m.loadSnapshot(fileName); err != nil {
+		return nil, err
+	}
+	if err := m.replay(fileName); err != nil {
+		return nil, err
+	}
+
+	producer, err := data.NewProducer(fileName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{
+		Memory:   m,
+		fileName: fileName,
+		producer: producer,
+		opts:     opts,
+	}, nil
+}
+
+func (f *File) Store(_ context.Context, id, longURL, userID string, redirect int) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry := newEntry(longURL, userID, redirect)
+	storedID, seq, err := f.store(id, entry)
+	if err != nil {
+		return storedID, err
+	}
+	err = f.writeEvent(&data.Event{
+		Type:      data.EventCreated,
+		ID:        uint(seq),
+		Short:     id,
+		Long:      longURL,
+		UserID:    userID,
+		CreatedAt: &entry.createdAt,
+		Redirect:  redirect,
+	})
+	if err != nil {
+		f.revert(id, memoryEntry{}, false)
+		return "", err
+	}
+	return storedID, nil
+}
+
+func (f *File) StoreBatch(_ context.Context, pairs []database.RequestData) ([]BatchResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	results := make([]BatchResult, len(pairs))
+	for i, pair := range pairs {
+		entry := newEntry(pair.URL, pair.UserID, pair.Redirect)
+		storedID, seq, err := f.store(pair.ID, entry)
+		results[i] = BatchResult{ShortURL: storedID, Conflict: err != nil}
+		if err != nil {
+			continue
+		}
+
+		// Event writing
+		err = f.writeEvent(&data.Event{
+			Type:      data.EventCreated,
+			ID:        uint(seq),
+			Short:     pair.ID,
+			Long:      pair.URL,
+			UserID:    pair.UserID,
+			CreatedAt: &entry.createdAt,
+			Redirect:  pair.Redirect,
+		})
+		if err != nil {
+			f.revert(pair.ID, memoryEntry{}, false)
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+func (f *File) SetRedirect(_ context.Context, userID, id string, redirect int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	old, existed := f.entry(id)
+	entry, ok := f.setRedirect(id, userID, redirect)
+	if !ok {
+		return ErrNotFound
+	}
+	if err := f.writeEvent(entry.event(data.EventUpdated, id)); err != nil {
+		f.revert(id, old, existed)
+		return err
+	}
+	return nil
+}
+
+func (f *File) DeleteURLs(_ context.Context, userID string, ids []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, id := range ids {
+		old, existed := f.entry(id)
+		if !f.markDeleted(id, userID, now) {
+			continue
+		}
+		err := f.writeEvent(&data.Event{
+			Type:      data.EventDeleted,
+			Short:     id,
+			UserID:    userID,
+			DeletedAt: &now,
+		})
+		if err != nil {
+			f.revert(id, old, existed)
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *File) Import(_ context.Context, records []Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, r := range records {
+		old, existed := f.entry(r.ShortURL)
+		if err := f.importEvents(r); err != nil {
+			f.revert(r.ShortURL, old, existed)
+			return err
+		}
+	}
+	return nil
+}
+
+// importEvents imports r into memory and writes its events.
+func (f *File) importEvents(r Record) error {
+	seq, replaced := f.importRecord(r)
+
+	eventType := data.EventCreated
+	if replaced {
+		eventType = data.EventUpdated
+	}
+	event := &data.Event{
+		Type:     eventType,
+		ID:       uint(seq),
+		Short:    r.ShortURL,
+		Long:     r.OriginalURL,
+		UserID:   r.UserID,
+		Redirect: r.Redirect,
+	}
+	if !r.CreatedAt.IsZero() {
+		event.CreatedAt = &r.CreatedAt
+	}
+	if err := f.writeEvent(event); err != nil {
+		return err
+	}
+
+	if !r.Deleted {
+		return nil
+	}
+	deletedAt := time.Now().UTC()
+	return f.writeEvent(&data.Event{
+		Type:      data.EventDeleted,
+		Short:     r.ShortURL,
+		UserID:    r.UserID,
+		DeletedAt: &deletedAt,
+	})
+}
+
+func (f *File) RestoreURLs(_ context.Context, userID string, ids []string, since time.Time) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var restored []string
+	for _, id := range ids {
+		old, existed := f.entry(id)
+		entry, ok := f.restore(id, userID, since)
+		if !ok {
+			continue
+		}
+		// Restoring rewrites the link as it was, which replays the same way
+		// in every version that reads the file
+		if err := f.writeEvent(entry.event(data.EventUpdated, id)); err != nil {
+			f.revert(id, old, existed)
+			return restored, err
+		}
+		restored = append(restored, id)
+	}
+	return restored, nil
+}
+
+// Purge removes links deleted before the given time and compacts them out
+// of the event file.
+func (f *File) Purge(ctx context.Context, before time.Time) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n, err := f.Memory.Purge(ctx, before)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	return n, f.compact()
+}
+
+func (f *File) Close() error {
+	if f.done != nil {
+		close(f.done)
+		<-f.stopped
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.producer.Close()
+}
+
+// writeEvent appends event to the event file. Callers hold f.mu from
+// changing memory until the event is written, so events reach the file in
+// the order of the changes, and undo the change if writing fails.
+func (f *File) writeEvent(event *data.Event) error {
+	return f.producer.WriteEvent(event)
+}
+
+// apply replays a single event read from the event file.
+func (m *Memory) apply(event data.Event) error {
+	switch event.Type {
+	case data.EventCreated, data.EventUpdated, "":
+		entry := memoryEntry{
+			longURL:  event.Long,
+			userID:   event.UserID,
+			redirect: event.Redirect,
+			seq:      uint64(event.ID),
+		}
+		if event.CreatedAt != nil {
+			entry.createdAt = *event.CreatedAt
+		}
+		m.putEntry(event.Short, entry)
+		m.raiseCounter(entry.seq)
+	case data.EventDeleted:
+		// Events written before deletion times were recorded start the
+		// retention period over
+		deletedAt := time.Now().UTC()
+		if event.DeletedAt != nil {
+			deletedAt = *event.DeletedAt
+		}
+		m.markDeleted(event.Short, event.UserID, deletedAt)
+	default:
+		return fmt.Errorf("unknown event type %q for %s", event.Type, event.Short)
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vkobazev/goShortenerUrl/internal/data"
+	"github.com/vkobazev/goShortenerUrl/internal/database"
+	"github.com/vkobazev/goShortenerUrl/internal/storage"
+	"github.com/vkobazev/goShortenerUrl/internal/storage/storagetest"
+)
+
+func TestFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "data.json")
+
+	storagetest.RunPersistent(t, func(t *testing.T) storage.Storage {
+		s, err := storage.NewFile(fileName, data.Options{})
+		require.NoError(t, err)
+		return s
+	})
+}
+
+func TestFileBinary(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "data.bin")
+
+	storagetest.RunPersistent(t, func(t *testing.T) storage.Storage {
+		s, err := storage.NewFile(fileName, data.Options{Format: data.FormatBinary})
+		require.NoError(t, err)
+		return s
+	})
+}
+
+func TestFileReplay(t *testing.T) {
+	ctx := context.Background()
+	fileName := filepath.Join(t.TempDir(), "data.json")
+
+	// Lines without a type come from files written before typed events
+	log := `{"id":1,"short_url":"legacy","original_url":"https://legacy.example","user_id":"u1"}
+{"type":"created","id":2,"short_url":"abc","original_url":"https://a.example","user_id":"u1"}
+{"type":"updated","id":3,"short_url":"abc","original_url":"https://b.example","user_id":"u2"}
+{"type":"deleted","short_url":"legacy","user_id":"u1"}
+{"type":"created","id":4,"short_url":"old","original_url":"https://old.example","user_id":"u1"}
+{"type":"deleted","short_url":"old","user_id":"u1","deleted_at":"2024-09-26T14:46:13Z"}
+`
+	require.NoError(t, os.WriteFile(fileName, []byte(log), 0666))
+
+	s, err := storage.NewFile(fileName, data.Options{})
+	require.NoError(t, err)
+	defer s.Close()
+
+	_, err = s.Get(ctx, "legacy")
+	assert.ErrorIs(t, err, storage.ErrDeleted)
+
+	long, err := s.Get(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://b.example", long.OriginalURL)
+
+	urls, err := s.GetURLsByUser(ctx, "u2")
+	require.NoError(t, err)
+	assert.Equal(t, []database.URLResponse{{ShortURL: "abc", OriginalURL: "https://b.example"}}, urls)
+	assert.Equal(t, uint64(4), s.Counter())
+
+	// Retention runs from the recorded deletion time, or from now for
+	// events that have none
+	n, err := s.Purge(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = s.Get(ctx, "old")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.Get(ctx, "legacy")
+	assert.ErrorIs(t, err, storage.ErrDeleted)
+}
+
+// TestFileCompacted runs the suite with the event file compacted on every
+// open, so restarts go through the snapshot.
+func TestFileCompacted(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "data.json")
+
+	storagetest.RunPersistent(t, func(t *testing.T) storage.Storage {
+		s, err := storage.NewFile(fileName, data.Options{})
+		require.NoError(t, err)
+		require.NoError(t, s.Compact())
+		return s
+	})
+}
+
+func TestFileCompact(t *testing.T) {
+	ctx := context.Background()
+	fileName := filepath.Join(t.TempDir(), "data.json")
+
+	s, err := storage.NewFile(fileName, data.Options{})
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err := s.Store(ctx, fmt.Sprintf("id%d", i), fmt.Sprintf("https://example.com/%d", i), "u1", 0)
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.DeleteURLs(ctx, "u1", []string{"id3"}))
+	log, err := os.ReadFile(fileName)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Compact())
+	info, err := os.Stat(fileName)
+	require.NoError(t, err)
+	assert.Zero(t, info.Size(), "event file must be truncated")
+
+	// Events after the snapshot go to the tail
+	_, err = s.Store(ctx, "tail", "https://example.com/tail", "u1", 0)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	check := func(t *testing.T) {
+		s, err := storage.NewFile(fileName, data.Options{})
+		require.NoError(t, err)
+		defer s.Close()
+
+		for _, id := range []string{"id0", "id9", "tail"} {
+			_, err := s.Get(ctx, id)
+			require.NoError(t, err)
+		}
+		_, err = s.Get(ctx, "id3")
+		assert.ErrorIs(t, err, storage.ErrDeleted)
+		assert.Equal(t, uint64(11), s.Counter())
+	}
+	t.Run("Restart", check)
+
+	// Crash after the snapshot was written but before truncation: the old
+	// events are replayed over the snapshot.
+	tail, err := os.ReadFile(fileName)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(fileName, append(log, tail...), 0666))
+	t.Run("CrashBeforeTruncate", check)
+}
+
+func TestFileCompactEvery(t *testing.T) {
+	ctx := context.Background()
+	fileName := filepath.Join(t.TempDir(), "data.json")
+
+	s, err := storage.NewFile(fileName, data.Options{})
+	require.NoError(t, err)
+	s.CompactEvery(10 * time.Millisecond)
+
+	_, err = s.Store(ctx, "id", "https://example.com", "u1", 0)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(fileName + ".snapshot")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, s.Close())
+
+	s, err = storage.NewFile(fileName, data.Options{})
+	require.NoError(t, err)
+	defer s.Close()
+	long, err := s.Get(ctx, "id")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", long.OriginalURL)
+}
+
+// TestFileConcurrentChanges deletes, restores and updates links at once and
+// checks that a restart replays the same state.
+func TestFileConcurrentChanges(t *testing.T) {
+	ctx := context.Background()
+	fileName := filepath.Join(t.TempDir(), "data.json")
+
+	s, err := storage.NewFile(fileName, data.Options{})
+	require.NoError(t, err)
+	ids := make([]string, 20)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("id%d", i)
+		_, err := s.Store(ctx, ids[i], fmt.Sprintf("https://example.com/%d", i), "u1", 0)
+		require.NoError(t, err)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 3; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for round := 0; round < 50; round++ {
+				for _, id := range ids {
+					switch w {
+					case 0:
+						assert.NoError(t, s.DeleteURLs(ctx, "u1", []string{id}))
+					case 1:
+						_, err := s.RestoreURLs(ctx, "u1", []string{id}, time.Time{})
+						assert.NoError(t, err)
+					default:
+						err := s.SetRedirect(ctx, "u1", id, 301+round%2)
+						assert.True(t, err == nil || errors.Is(err, storage.ErrNotFound), err)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	want := make(map[string]error)
+	links := make(map[string]storage.Link)
+	for _, id := range ids {
+		links[id], want[id] = s.Get(ctx, id)
+	}
+	require.NoError(t, s.Close())
+
+	s, err = storage.NewFile(fileName, data.Options{})
+	require.NoError(t, err)
+	defer s.Close()
+	for _, id := range ids {
+		link, err := s.Get(ctx, id)
+		assert.Equal(t, want[id], err, id)
+		assert.Equal(t, links[id], link, id)
+	}
+}
+
+// TestFileWriteFailure checks that a change whose event cannot be written
+// is not kept in memory either.
+func TestFileWriteFailure(t *testing.T) {
+	ctx := context.Background()
+	fileName := filepath.Join(t.TempDir(), "data.json")
+
+	s, err := storage.NewFile(fileName, data.Options{})
+	require.NoError(t, err)
+	_, err = s.Store(ctx, "kept", "https://example.com/kept", "u1", 301)
+	require.NoError(t, err)
+	// Closing the event file makes every further write fail
+	require.NoError(t, s.Close())
+
+	_, err = s.Store(ctx, "lost", "https://example.com/lost", "u1", 0)
+	assert.Error(t, err)
+	_, err = s.Get(ctx, "lost")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	storedID, err := s.Store(ctx, "again", "https://example.com/lost", "u1", 0)
+	assert.NotErrorIs(t, err, storage.ErrConflict, "a failed store must not hold its URL")
+	assert.Empty(t, storedID)
+
+	assert.Error(t, s.SetRedirect(ctx, "u1", "kept", 308))
+	assert.Error(t, s.DeleteURLs(ctx, "u1", []string{"kept"}))
+	link, err := s.Get(ctx, "kept")
+	require.NoError(t, err)
+	assert.Equal(t, storage.Link{OriginalURL: "https://example.com/kept", Redirect: 301}, link)
+}
@@ -0,0 +1,160 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vkobazev/goShortenerUrl/internal/database"
+	"github.com/vkobazev/goShortenerUrl/internal/storage"
+)
+
+// fakeDB answers redirect lookups after a fixed latency and counts the
+// queries it served. Other URLDB methods are not implemented.
+type fakeDB struct {
+	storage.URLDB
+	latency time.Duration
+	release chan struct{} // if set, queries wait for it to be closed
+	queries atomic.Int64
+}
+
+func (f *fakeDB) GetLink(ctx context.Context, shortURL string) (database.Link, bool, error) {
+	f.queries.Add(1)
+	if f.release != nil {
+		<-f.release
+	}
+	time.Sleep(f.latency)
+	if shortURL == "missing" {
+		return database.Link{}, false, database.ErrNotFound
+	}
+	return database.Link{OriginalURL: "https://example.com/" + shortURL}, shortURL == "gone", nil
+}
+
+func (f *fakeDB) GetLongURL(ctx context.Context, shortURL string) (string, string, error) {
+	f.queries.Add(1)
+	time.Sleep(f.latency)
+	return "https://example.com/" + shortURL, "user", nil
+}
+
+// twoQueryGet is the redirect lookup as it was before Get used a single
+// query: the deleted flag first, then the URL.
+func twoQueryGet(ctx context.Context, f *fakeDB, id string) (string, error) {
+	_, deleted, err := f.GetLink(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if deleted {
+		return "", storage.ErrDeleted
+	}
+	longURL, _, err := f.GetLongURL(ctx, id)
+	return longURL, err
+}
+
+func TestDatabaseGet(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeDB{}
+	d := storage.NewDatabase(fake)
+
+	got, err := d.Get(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/abc", got.OriginalURL)
+
+	_, err = d.Get(ctx, "gone")
+	assert.ErrorIs(t, err, storage.ErrDeleted)
+
+	_, err = d.Get(ctx, "missing")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	assert.Equal(t, int64(3), fake.queries.Load())
+}
+
+func TestDatabaseGetCoalesces(t *testing.T) {
+	const callers = 50
+
+	fake := &fakeDB{release: make(chan struct{})}
+	d := storage.NewDatabase(fake)
+
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := d.Get(context.Background(), "hot")
+			assert.NoError(t, err)
+			assert.Equal(t, "https://example.com/hot", got.OriginalURL)
+		}()
+	}
+
+	// A caller that gives up does not cancel the query for the others
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := d.Get(ctx, "hot")
+		done <- err
+	}()
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	// Give every caller time to join the query in flight
+	time.Sleep(100 * time.Millisecond)
+	close(fake.release)
+	wg.Wait()
+
+	assert.Equal(t, int64(1), fake.queries.Load())
+}
+
+// BenchmarkRedirectLookup compares the old two-query lookup with Get when
+// many requests hit one link at once (hot) or each hit their own (spread).
+func BenchmarkRedirectLookup(b *testing.B) {
+	const latency = 200 * time.Microsecond
+
+	lookups := map[string]func(*fakeDB) func(context.Context, string) (string, error){
+		"two_queries": func(f *fakeDB) func(context.Context, string) (string, error) {
+			return func(ctx context.Context, id string) (string, error) {
+				return twoQueryGet(ctx, f, id)
+			}
+		},
+		"single_query": func(f *fakeDB) func(context.Context, string) (string, error) {
+			s := storage.NewDatabase(f)
+			return func(ctx context.Context, id string) (string, error) {
+				link, err := s.Get(ctx, id)
+				return link.OriginalURL, err
+			}
+		},
+	}
+
+	for _, name := range []string{"two_queries", "single_query"} {
+		for _, hot := range []bool{true, false} {
+			pattern := "spread"
+			if hot {
+				pattern = "hot"
+			}
+			b.Run(name+"/"+pattern, func(b *testing.B) {
+				fake := &fakeDB{latency: latency}
+				get := lookups[name](fake)
+				var next atomic.Int64
+
+				b.SetParallelism(16)
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					ctx := context.Background()
+					for pb.Next() {
+						id := "hot"
+						if !hot {
+							id = fmt.Sprint(next.Add(1))
+						}
+						if _, err := get(ctx, id); err != nil {
+							b.Error(err)
+						}
+					}
+				})
+				b.ReportMetric(float64(fake.queries.Load())/float64(b.N), "queries/op")
+			})
+		}
+	}
+}
@@ -0,0 +1,457 @@
+package storage
+
+import (
+	"context"
+	"hash/maphash"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vkobazev/goShortenerUrl/internal/database"
+)
+
+// shardCount must be a power of two.
+const shardCount = 32
+
+type memoryEntry struct {
+	longURL   string
+	userID    string
+	redirect  int
+	deleted   bool
+	seq       uint64 // counter value when the link was last written
+	createdAt time.Time
+	deletedAt time.Time
+}
+
+type ownerKey struct {
+	userID  string
+	longURL string
+}
+
+type urlShard struct {
+	mu   sync.RWMutex
+	urls map[string]memoryEntry
+}
+
+type reShard struct {
+	mu     sync.RWMutex
+	reURLs map[ownerKey]string
+}
+
+// Memory keeps links in process memory only. Both the ID index and the
+// reverse (user, URL) index are split into lock-striped shards so that
+// concurrent handlers rarely contend.
+type Memory struct {
+	counter atomic.Uint64
+	seed    maphash.Seed
+	urls    [shardCount]urlShard
+	reURLs  [shardCount]reShard
+}
+
+func NewMemory() *Memory {
+	m := &Memory{seed: maphash.MakeSeed()}
+	for i := range m.urls {
+		m.urls[i].urls = make(map[string]memoryEntry)
+		m.reURLs[i].reURLs = make(map[ownerKey]string)
+	}
+	return m
+}
+
+func (m *Memory) Store(_ context.Context, id, longURL, userID string, redirect int) (string, error) {
+	storedID, _, err := m.store(id, newEntry(longURL, userID, redirect))
+	return storedID, err
+}
+
+func (m *Memory) Get(_ context.Context, id string) (Link, error) {
+	shard := m.urlShard(id)
+	shard.mu.RLock()
+	entry, ok := shard.urls[id]
+	shard.mu.RUnlock()
+
+	if !ok {
+		return Link{}, ErrNotFound
+	}
+	if entry.deleted {
+		return Link{}, ErrDeleted
+	}
+	return Link{OriginalURL: entry.longURL, Redirect: entry.redirect}, nil
+}
+
+func (m *Memory) SetRedirect(_ context.Context, userID, id string, redirect int) error {
+	if _, ok := m.setRedirect(id, userID, redirect); !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *Memory) StoreBatch(_ context.Context, pairs []database.RequestData) ([]BatchResult, error) {
+	results := make([]BatchResult, len(pairs))
+	for i, pair := range pairs {
+		storedID, _, err := m.store(pair.ID, newEntry(pair.URL, pair.UserID, pair.Redirect))
+		results[i] = BatchResult{ShortURL: storedID, Conflict: err != nil}
+	}
+	return results, nil
+}
+
+func (m *Memory) GetURLsByUser(_ context.Context, userID string) ([]database.URLResponse, error) {
+	var urls []database.URLResponse
+	for i := range m.urls {
+		shard := &m.urls[i]
+		shard.mu.RLock()
+		for id, entry := range shard.urls {
+			if entry.userID != userID || entry.deleted {
+				continue
+			}
+			urls = append(urls, database.URLResponse{
+				ShortURL:    id,
+				OriginalURL: entry.longURL,
+			})
+		}
+		shard.mu.RUnlock()
+	}
+	return urls, nil
+}
+
+func (m *Memory) DeleteURLs(_ context.Context, userID string, ids []string) error {
+	now := time.Now().UTC()
+	for _, id := range ids {
+		m.markDeleted(id, userID, now)
+	}
+	return nil
+}
+
+func (m *Memory) GetDeletedURLsByUser(_ context.Context, userID string, since time.Time) ([]database.DeletedURL, error) {
+	var urls []database.DeletedURL
+	for i := range m.urls {
+		shard := &m.urls[i]
+		shard.mu.RLock()
+		for id, entry := range shard.urls {
+			if entry.userID != userID || !entry.deleted || entry.deletedAt.Before(since) {
+				continue
+			}
+			urls = append(urls, database.DeletedURL{
+				ShortURL:    id,
+				OriginalURL: entry.longURL,
+				DeletedAt:   entry.deletedAt,
+			})
+		}
+		shard.mu.RUnlock()
+	}
+
+	sort.Slice(urls, func(i, j int) bool { return urls[i].DeletedAt.After(urls[j].DeletedAt) })
+	return urls, nil
+}
+
+func (m *Memory) RestoreURLs(_ context.Context, userID string, ids []string, since time.Time) ([]string, error) {
+	var restored []string
+	for _, id := range ids {
+		if _, ok := m.restore(id, userID, since); ok {
+			restored = append(restored, id)
+		}
+	}
+	return restored, nil
+}
+
+func (m *Memory) Count(_ context.Context) (int, error) {
+	n := 0
+	for i := range m.urls {
+		shard := &m.urls[i]
+		shard.mu.RLock()
+		n += len(shard.urls)
+		shard.mu.RUnlock()
+	}
+	return n, nil
+}
+
+func (m *Memory) Purge(_ context.Context, before time.Time) (int, error) {
+	return len(m.purge(before)), nil
+}
+
+func (m *Memory) Export(_ context.Context, fn func(Record) error) error {
+	type seqRecord struct {
+		Record
+		seq uint64
+	}
+
+	var records []seqRecord
+	for i := range m.urls {
+		shard := &m.urls[i]
+		shard.mu.RLock()
+		for id, entry := range shard.urls {
+			records = append(records, seqRecord{entry.record(id), entry.seq})
+		}
+		shard.mu.RUnlock()
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].seq < records[j].seq })
+	for _, r := range records {
+		if err := fn(r.Record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Import(_ context.Context, records []Record) error {
+	for _, r := range records {
+		m.importRecord(r)
+	}
+	return nil
+}
+
+func (m *Memory) Ping(_ context.Context) error {
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+// Counter returns the number of links written so far.
+func (m *Memory) Counter() uint64 {
+	return m.counter.Load()
+}
+
+// importRecord stores r as is and returns the sequence number of the link
+// and whether an existing link was overwritten.
+func (m *Memory) importRecord(r Record) (uint64, bool) {
+	seq, replaced := m.put(r.ShortURL, memoryEntry{
+		longURL:   r.OriginalURL,
+		userID:    r.UserID,
+		redirect:  r.Redirect,
+		createdAt: r.CreatedAt,
+	})
+	if r.Deleted {
+		// Records carry no deletion time, so retention starts over
+		m.markDeleted(r.ShortURL, r.UserID, time.Now().UTC())
+	}
+	return seq, replaced
+}
+
+func (e memoryEntry) record(id string) Record {
+	return Record{
+		ShortURL:    id,
+		OriginalURL: e.longURL,
+		UserID:      e.userID,
+		Deleted:     e.deleted,
+		CreatedAt:   e.createdAt,
+		Redirect:    e.redirect,
+	}
+}
+
+func newEntry(longURL, userID string, redirect int) memoryEntry {
+	return memoryEntry{longURL: longURL, userID: userID, redirect: redirect, createdAt: time.Now().UTC()}
+}
+
+func (m *Memory) urlShard(id string) *urlShard {
+	return &m.urls[maphash.String(m.seed, id)&(shardCount-1)]
+}
+
+func (m *Memory) reShard(key ownerKey) *reShard {
+	var h maphash.Hash
+	h.SetSeed(m.seed)
+	h.WriteString(key.userID)
+	h.WriteByte(0)
+	h.WriteString(key.longURL)
+	return &m.reURLs[h.Sum64()&(shardCount-1)]
+}
+
+// store inserts entry as id unless its owner already has its URL or id is
+// taken; existing links are never overwritten. The reverse shard stays
+// locked while checking and inserting, so concurrent stores of the same
+// URL agree on a single ID. It returns the ID holding the URL and the
+// sequence number of the new link, or the existing ID with ErrConflict, or
+// ErrIDTaken.
+func (m *Memory) store(id string, entry memoryEntry) (string, uint64, error) {
+	key := ownerKey{entry.userID, entry.longURL}
+	re := m.reShard(key)
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	if oldID, ok := re.reURLs[key]; ok {
+		return oldID, 0, ErrConflict
+	}
+	seq, ok := m.insert(id, entry)
+	if !ok {
+		return "", 0, ErrIDTaken
+	}
+	re.reURLs[key] = id
+	return id, seq, nil
+}
+
+// put inserts or overwrites id, keeping the reverse index in sync. It
+// returns the sequence number of the written link and whether an existing
+// link was overwritten.
+func (m *Memory) put(id string, entry memoryEntry) (uint64, bool) {
+	entry.seq = m.counter.Add(1)
+	return entry.seq, m.putEntry(id, entry)
+}
+
+// putEntry is put with the sequence number already set in entry.
+func (m *Memory) putEntry(id string, entry memoryEntry) bool {
+	old, replaced := m.swap(id, entry)
+	if replaced {
+		m.unindex(old, id)
+	}
+
+	key := ownerKey{entry.userID, entry.longURL}
+	re := m.reShard(key)
+	re.mu.Lock()
+	re.reURLs[key] = id
+	re.mu.Unlock()
+
+	return replaced
+}
+
+// raiseCounter moves the counter up to seq if it is behind.
+func (m *Memory) raiseCounter(seq uint64) {
+	for {
+		cur := m.counter.Load()
+		if cur >= seq || m.counter.CompareAndSwap(cur, seq) {
+			return
+		}
+	}
+}
+
+// entry returns the link stored as id.
+func (m *Memory) entry(id string) (memoryEntry, bool) {
+	shard := m.urlShard(id)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	entry, ok := shard.urls[id]
+	return entry, ok
+}
+
+// revert puts old back as id, or removes id if it did not exist, undoing a
+// change that could not be persisted.
+func (m *Memory) revert(id string, old memoryEntry, existed bool) {
+	if existed {
+		m.putEntry(id, old)
+		return
+	}
+
+	shard := m.urlShard(id)
+	shard.mu.Lock()
+	entry, ok := shard.urls[id]
+	delete(shard.urls, id)
+	shard.mu.Unlock()
+
+	if ok {
+		m.unindex(entry, id)
+	}
+}
+
+// markDeleted marks id as deleted at the given time if it belongs to
+// userID. It reports whether the link changed.
+func (m *Memory) markDeleted(id, userID string, at time.Time) bool {
+	shard := m.urlShard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	entry, ok := shard.urls[id]
+	if !ok || entry.userID != userID || entry.deleted {
+		return false
+	}
+	entry.deleted = true
+	entry.deletedAt = at
+	shard.urls[id] = entry
+	return true
+}
+
+// setRedirect changes the status code of id if it belongs to userID and is
+// not deleted. It returns the changed link and whether it exists.
+func (m *Memory) setRedirect(id, userID string, redirect int) (memoryEntry, bool) {
+	shard := m.urlShard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	entry, ok := shard.urls[id]
+	if !ok || entry.userID != userID || entry.deleted {
+		return memoryEntry{}, false
+	}
+	entry.redirect = redirect
+	shard.urls[id] = entry
+	return entry, true
+}
+
+// restore undeletes id if it belongs to userID and was deleted at or after
+// since. It returns the restored link and whether it changed.
+func (m *Memory) restore(id, userID string, since time.Time) (memoryEntry, bool) {
+	shard := m.urlShard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	entry, ok := shard.urls[id]
+	if !ok || entry.userID != userID || !entry.deleted || entry.deletedAt.Before(since) {
+		return memoryEntry{}, false
+	}
+	entry.deleted = false
+	entry.deletedAt = time.Time{}
+	shard.urls[id] = entry
+	return entry, true
+}
+
+// purge removes links deleted before the given time and returns their IDs.
+func (m *Memory) purge(before time.Time) []string {
+	var purged []string
+	for i := range m.urls {
+		shard := &m.urls[i]
+		var ids []string
+		var old []memoryEntry
+
+		shard.mu.Lock()
+		for id, entry := range shard.urls {
+			if entry.deleted && entry.deletedAt.Before(before) {
+				delete(shard.urls, id)
+				ids = append(ids, id)
+				old = append(old, entry)
+			}
+		}
+		shard.mu.Unlock()
+
+		for j, id := range ids {
+			m.unindex(old[j], id)
+		}
+		purged = append(purged, ids...)
+	}
+	return purged
+}
+
+// insert stores entry as id unless id is taken. It returns the sequence
+// number of the new link and whether it was stored.
+func (m *Memory) insert(id string, entry memoryEntry) (uint64, bool) {
+	shard := m.urlShard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if _, ok := shard.urls[id]; ok {
+		return 0, false
+	}
+	entry.seq = m.counter.Add(1)
+	shard.urls[id] = entry
+	return entry.seq, true
+}
+
+// swap replaces the entry for id and returns the previous one.
+func (m *Memory) swap(id string, entry memoryEntry) (memoryEntry, bool) {
+	shard := m.urlShard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	old, ok := shard.urls[id]
+	shard.urls[id] = entry
+	return old, ok
+}
+
+// unindex removes the reverse entry of old if it still points to id.
+func (m *Memory) unindex(old memoryEntry, id string) {
+	key := ownerKey{old.userID, old.longURL}
+	re := m.reShard(key)
+	re.mu.Lock()
+	if re.reURLs[key] == id {
+		delete(re.reURLs, key)
+	}
+	re.mu.Unlock()
+}
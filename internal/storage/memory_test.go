@@ -0,0 +1,53 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vkobazev/goShortenerUrl/internal/storage"
+	"github.com/vkobazev/goShortenerUrl/internal/storage/storagetest"
+)
+
+func TestMemory(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return storage.NewMemory()
+	})
+}
+
+func TestMemoryConcurrentSameURL(t *testing.T) {
+	const workers = 64
+
+	ctx := context.Background()
+	m := storage.NewMemory()
+
+	var wg sync.WaitGroup
+	ids := make([]string, workers)
+	created := make([]bool, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			id, err := m.Store(ctx, fmt.Sprintf("id%d", w), "https://shared.example", "user", 0)
+			if !errors.Is(err, storage.ErrConflict) {
+				assert.NoError(t, err)
+			}
+			ids[w], created[w] = id, err == nil
+		}(w)
+	}
+	wg.Wait()
+
+	winners := 0
+	for w := range ids {
+		assert.Equal(t, ids[0], ids[w], "concurrent stores of one URL must agree on its ID")
+		if created[w] {
+			winners++
+		}
+	}
+	assert.Equal(t, 1, winners)
+	assert.Equal(t, uint64(1), m.Counter())
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/vkobazev/goShortenerUrl/internal/data"
+)
+
+// A snapshot holds the state of a File storage as a minimal event stream:
+// one created event per link followed by a deleted event for every deleted
+// link. Startup loads the snapshot and then replays the event file, which
+// only contains the tail written after the snapshot was taken.
+
+func snapshotPath(fileName string) string {
+	return fileName + ".snapshot"
+}
+
+// event returns an event of the given type that writes entry as id.
+func (e memoryEntry) event(eventType data.EventType, id string) *data.Event {
+	event := &data.Event{
+		Type:     eventType,
+		ID:       uint(e.seq),
+		Short:    id,
+		Long:     e.longURL,
+		UserID:   e.userID,
+		Redirect: e.redirect,
+	}
+	if !e.createdAt.IsZero() {
+		createdAt := e.createdAt
+		event.CreatedAt = &createdAt
+	}
+	return event
+}
+
+// snapshotEvents returns the current state as events.
+func (m *Memory) snapshotEvents() []data.Event {
+	var created, deleted []data.Event
+	for i := range m.urls {
+		shard := &m.urls[i]
+		shard.mu.RLock()
+		for id, entry := range shard.urls {
+			created = append(created, *entry.event(data.EventCreated, id))
+			if entry.deleted {
+				deletedAt := entry.deletedAt
+				deleted = append(deleted, data.Event{
+					Type:      data.EventDeleted,
+					Short:     id,
+					UserID:    entry.userID,
+					DeletedAt: &deletedAt,
+				})
+			}
+		}
+		shard.mu.RUnlock()
+	}
+
+	sort.Slice(created, func(i, j int) bool { return created[i].ID < created[j].ID })
+	return append(created, deleted...)
+}
+
+// loadSnapshot applies the snapshot of fileName, if there is one.
+func (m *Memory) loadSnapshot(fileName string) error {
+	path := snapshotPath(fileName)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	return m.replay(path)
+}
+
+// replay applies every event stored in fileName.
+func (m *Memory) replay(fileName string) error {
+	consumer, err := data.NewConsumer(fileName)
+	if err != nil {
+		return err
+	}
+	events, err := consumer.ReadAllEvents()
+	consumer.Close()
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if err := m.apply(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSnapshot atomically replaces the snapshot of fileName with events.
+func writeSnapshot(fileName string, format data.Format, events []data.Event) error {
+	path := snapshotPath(fileName)
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+
+	p, err := data.NewProducer(tmp, data.Options{Format: format})
+	if err != nil {
+		return err
+	}
+	for i := range events {
+		if err := p.WriteEvent(&events[i]); err != nil {
+			p.Close()
+			return err
+		}
+	}
+	if err := p.Sync(); err != nil {
+		p.Close()
+		return err
+	}
+	if err := p.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Compact writes a snapshot of the current state and truncates the event
+// file. Writers are blocked while it runs. A crash between the two steps is
+// harmless: replaying the whole event file over the new snapshot yields the
+// same state.
+func (f *File) Compact() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.compact()
+}
+
+// compact is Compact with f.mu held.
+func (f *File) compact() error {
+	if err := writeSnapshot(f.fileName, f.opts.Format, f.snapshotEvents()); err != nil {
+		return err
+	}
+
+	if err := f.producer.Close(); err != nil {
+		return err
+	}
+	truncErr := os.Truncate(f.fileName, 0)
+	producer, err := data.NewProducer(f.fileName, f.opts)
+	if err != nil {
+		return err
+	}
+	f.producer = producer
+	return truncErr
+}
+
+// CompactEvery runs Compact periodically until the storage is closed.
+func (f *File) CompactEvery(interval time.Duration) {
+	f.done = make(chan struct{})
+	f.stopped = make(chan struct{})
+
+	go func() {
+		defer close(f.stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := f.Compact(); err != nil {
+					log.Printf("Error compacting event file: %v", err)
+				}
+			case <-f.done:
+				return
+			}
+		}
+	}()
+}
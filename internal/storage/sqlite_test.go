@@ -0,0 +1,23 @@
+package storage_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vkobazev/goShortenerUrl/internal/database"
+	"github.com/vkobazev/goShortenerUrl/internal/storage"
+	"github.com/vkobazev/goShortenerUrl/internal/storage/storagetest"
+)
+
+func TestSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shortener.db")
+
+	storagetest.RunPersistent(t, func(t *testing.T) storage.Storage {
+		db, err := database.NewSQLite(path)
+		require.NoError(t, err)
+		require.NoError(t, db.CreateTable(context.Background()))
+		return storage.NewDatabase(db)
+	})
+}
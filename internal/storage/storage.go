@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/vkobazev/goShortenerUrl/internal/database"
+)
+
+// Record is a link with everything needed to move it between backends.
+type Record = database.URLRecord
+
+// Link is what a redirect needs: the original URL and its status code.
+type Link = database.Link
+
+// BatchResult is the outcome of storing one pair of a batch.
+type BatchResult = database.BatchResult
+
+// Errors returned by every backend; check them with errors.Is.
+var (
+	// ErrNotFound is returned by Get when no link has the requested ID.
+	ErrNotFound = database.ErrNotFound
+	// ErrDeleted is returned by Get when the link was deleted by its owner.
+	ErrDeleted = database.ErrDeleted
+	// ErrConflict is returned by Store when the user already has the URL.
+	ErrConflict = database.ErrConflict
+	// ErrIDTaken is returned by Store when another link has the ID.
+	ErrIDTaken = database.ErrIDTaken
+)
+
+// Storage is implemented by every backend that keeps short links.
+type Storage interface {
+	// Store saves longURL under id for userID. If userID already has
+	// longURL, the existing id is returned together with ErrConflict. An
+	// existing link is never overwritten: if id is taken, ErrIDTaken is
+	// returned and the caller may retry with another id. redirect is the
+	// status code of the link, 0 for the server default.
+	Store(ctx context.Context, id, longURL, userID string, redirect int) (storedID string, err error)
+	// Get returns the link stored as id, ErrNotFound if there is no such
+	// link or ErrDeleted if it was deleted.
+	Get(ctx context.Context, id string) (Link, error)
+	// StoreBatch saves every pair using its correlation ID as the short ID
+	// and returns a result per pair, in order. Existing links are never
+	// overwritten: a pair whose URL its owner already has, or whose ID is
+	// taken, is reported as a conflict.
+	StoreBatch(ctx context.Context, pairs []database.RequestData) ([]BatchResult, error)
+	// GetURLsByUser lists short IDs and original URLs owned by userID,
+	// leaving out deleted links.
+	GetURLsByUser(ctx context.Context, userID string) ([]database.URLResponse, error)
+	// SetRedirect changes the status code of id owned by userID, or returns
+	// ErrNotFound if userID has no such link or it is deleted.
+	SetRedirect(ctx context.Context, userID, id string, redirect int) error
+	// DeleteURLs marks ids owned by userID as deleted.
+	DeleteURLs(ctx context.Context, userID string, ids []string) error
+	// GetDeletedURLsByUser lists links of userID deleted at or after since,
+	// most recently deleted first.
+	GetDeletedURLsByUser(ctx context.Context, userID string, since time.Time) ([]database.DeletedURL, error)
+	// RestoreURLs undeletes ids of userID deleted at or after since and
+	// returns the restored ones.
+	RestoreURLs(ctx context.Context, userID string, ids []string, since time.Time) ([]string, error)
+	// Count returns the number of stored links, deleted ones included.
+	Count(ctx context.Context) (int, error)
+	// Purge removes links deleted before the given time for good and
+	// returns how many were removed.
+	Purge(ctx context.Context, before time.Time) (int, error)
+	// Export calls fn for every stored link, including deleted ones.
+	Export(ctx context.Context, fn func(Record) error) error
+	// Import stores records under their own IDs, overwriting existing links.
+	Import(ctx context.Context, records []Record) error
+	Ping(ctx context.Context) error
+	Close() error
+}
@@ -0,0 +1,586 @@
+// Package storagetest contains the conformance suite every storage backend
+// must pass.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vkobazev/goShortenerUrl/internal/database"
+	"github.com/vkobazev/goShortenerUrl/internal/storage"
+)
+
+// Opener opens a storage. Every call within one Run must open the same
+// underlying data, so that reopening simulates a server restart.
+type Opener func(t *testing.T) storage.Storage
+
+// Run checks the behavior shared by all backends.
+func Run(t *testing.T, open Opener) {
+	t.Run("Create", func(t *testing.T) { testCreate(t, open) })
+	t.Run("DuplicateConflict", func(t *testing.T) { testDuplicateConflict(t, open) })
+	t.Run("IDTaken", func(t *testing.T) { testIDTaken(t, open) })
+	t.Run("Count", func(t *testing.T) { testCount(t, open) })
+	t.Run("Redirect", func(t *testing.T) { testRedirect(t, open) })
+	t.Run("Batch", func(t *testing.T) { testBatch(t, open) })
+	t.Run("BatchConflicts", func(t *testing.T) { testBatchConflicts(t, open) })
+	t.Run("UserListing", func(t *testing.T) { testUserListing(t, open) })
+	t.Run("SoftDelete", func(t *testing.T) { testSoftDelete(t, open) })
+	t.Run("Purge", func(t *testing.T) { testPurge(t, open) })
+	t.Run("Restore", func(t *testing.T) { testRestore(t, open) })
+	t.Run("Concurrent", func(t *testing.T) { testConcurrent(t, open) })
+	t.Run("ConcurrentSameURL", func(t *testing.T) { testConcurrentSameURL(t, open) })
+	t.Run("ExportImport", func(t *testing.T) { testExportImport(t, open) })
+}
+
+// RunPersistent runs Run and additionally checks that data survives
+// reopening the storage.
+func RunPersistent(t *testing.T, open Opener) {
+	Run(t, open)
+	t.Run("RestartPersistence", func(t *testing.T) { testRestartPersistence(t, open) })
+}
+
+// suffix keeps IDs unique when a backend's data outlives a single test run.
+func suffix() string {
+	return fmt.Sprintf("%08x", rand.Uint32())
+}
+
+func openClosed(t *testing.T, open Opener) storage.Storage {
+	s := open(t)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func testCreate(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := openClosed(t, open)
+	id, user, long := "c"+suffix(), "u"+suffix(), "https://create.example/"+suffix()
+
+	storedID, err := s.Store(ctx, id, long, user, 0)
+	require.NoError(t, err)
+	assert.Equal(t, id, storedID)
+
+	got, err := s.Get(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, long, got.OriginalURL)
+
+	_, err = s.Get(ctx, "missing"+suffix())
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testDuplicateConflict(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := openClosed(t, open)
+	id, user, long := "d"+suffix(), "u"+suffix(), "https://dup.example/"+suffix()
+
+	_, err := s.Store(ctx, id, long, user, 0)
+	require.NoError(t, err)
+
+	storedID, err := s.Store(ctx, "d"+suffix(), long, user, 0)
+	assert.ErrorIs(t, err, storage.ErrConflict)
+	assert.Equal(t, id, storedID)
+
+	// The same URL shortened by another user is a separate link
+	otherID := "d" + suffix()
+	storedID, err = s.Store(ctx, otherID, long, "u"+suffix(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, otherID, storedID)
+}
+
+func testIDTaken(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := openClosed(t, open)
+	id, long := "t"+suffix(), "https://taken.example/"+suffix()
+
+	_, err := s.Store(ctx, id, long, "u"+suffix(), 0)
+	require.NoError(t, err)
+
+	// Another user's link under the same ID is refused, not overwritten
+	user := "u" + suffix()
+	storedID, err := s.Store(ctx, id, "https://taken.example/"+suffix(), user, 0)
+	assert.ErrorIs(t, err, storage.ErrIDTaken)
+	assert.Empty(t, storedID)
+
+	got, err := s.Get(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, long, got.OriginalURL)
+
+	// The refused URL is not stored at all and can take another ID
+	otherID := "t" + suffix()
+	storedID, err = s.Store(ctx, otherID, "https://taken.example/other", user, 0)
+	require.NoError(t, err)
+	assert.Equal(t, otherID, storedID)
+}
+
+func testCount(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := openClosed(t, open)
+	user := "u" + suffix()
+
+	before, err := s.Count(ctx)
+	require.NoError(t, err)
+
+	id := "n" + suffix()
+	_, err = s.Store(ctx, id, "https://count.example/"+suffix(), user, 0)
+	require.NoError(t, err)
+	_, err = s.Store(ctx, "n"+suffix(), "https://count.example/"+suffix(), user, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteURLs(ctx, user, []string{id}))
+
+	// Deleted links still hold their IDs and are counted
+	after, err := s.Count(ctx)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, after-before, 2)
+}
+
+func testRedirect(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := openClosed(t, open)
+	id, user := "s"+suffix(), "u"+suffix()
+
+	_, err := s.Store(ctx, id, "https://redirect.example/"+suffix(), user, 301)
+	require.NoError(t, err)
+	got, err := s.Get(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, 301, got.Redirect)
+
+	require.NoError(t, s.SetRedirect(ctx, user, id, 302))
+	got, err = s.Get(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, 302, got.Redirect)
+
+	// Only the owner can change a live link
+	assert.ErrorIs(t, s.SetRedirect(ctx, "u"+suffix(), id, 308), storage.ErrNotFound)
+	assert.ErrorIs(t, s.SetRedirect(ctx, user, "missing"+suffix(), 308), storage.ErrNotFound)
+	require.NoError(t, s.DeleteURLs(ctx, user, []string{id}))
+	assert.ErrorIs(t, s.SetRedirect(ctx, user, id, 308), storage.ErrNotFound)
+
+	batch := []database.RequestData{
+		{ID: "s" + suffix(), URL: "https://redirect.example/" + suffix(), UserID: user, Redirect: 308},
+	}
+	_, err = s.StoreBatch(ctx, batch)
+	require.NoError(t, err)
+	got, err = s.Get(ctx, batch[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, 308, got.Redirect)
+}
+
+func testBatch(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := openClosed(t, open)
+	user := "u" + suffix()
+
+	pairs := make([]database.RequestData, 3)
+	for i := range pairs {
+		pairs[i] = database.RequestData{
+			ID:     "b" + suffix(),
+			URL:    "https://batch.example/" + suffix(),
+			UserID: user,
+		}
+	}
+	results, err := s.StoreBatch(ctx, pairs)
+	require.NoError(t, err)
+	require.Len(t, results, len(pairs))
+
+	for i, pair := range pairs {
+		assert.Equal(t, storage.BatchResult{ShortURL: pair.ID}, results[i])
+
+		got, err := s.Get(ctx, pair.ID)
+		require.NoError(t, err)
+		assert.Equal(t, pair.URL, got.OriginalURL)
+	}
+}
+
+func testBatchConflicts(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := openClosed(t, open)
+	user, other := "u"+suffix(), "u"+suffix()
+
+	taken, long := "t"+suffix(), "https://conflict.example/"+suffix()
+	_, err := s.Store(ctx, taken, long, user, 0)
+	require.NoError(t, err)
+
+	fresh, freshURL := "t"+suffix(), "https://conflict.example/"+suffix()
+	pairs := []database.RequestData{
+		// The user already has this URL
+		{ID: "t" + suffix(), URL: long, UserID: user},
+		// Another user may shorten the same URL
+		{ID: "t" + suffix(), URL: long, UserID: other},
+		// The ID belongs to another link
+		{ID: taken, URL: "https://conflict.example/" + suffix(), UserID: other},
+		{ID: fresh, URL: freshURL, UserID: user},
+		// Repeats within the batch
+		{ID: "t" + suffix(), URL: freshURL, UserID: user},
+		{ID: fresh, URL: "https://conflict.example/" + suffix(), UserID: user},
+	}
+
+	results, err := s.StoreBatch(ctx, pairs)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.BatchResult{
+		{ShortURL: taken, Conflict: true},
+		{ShortURL: pairs[1].ID},
+		{Conflict: true},
+		{ShortURL: fresh},
+		{ShortURL: fresh, Conflict: true},
+		{Conflict: true},
+	}, results)
+
+	// Nothing was overwritten
+	got, err := s.Get(ctx, taken)
+	require.NoError(t, err)
+	assert.Equal(t, long, got.OriginalURL)
+	got, err = s.Get(ctx, fresh)
+	require.NoError(t, err)
+	assert.Equal(t, freshURL, got.OriginalURL)
+	_, err = s.Get(ctx, pairs[0].ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	urls, err := s.GetURLsByUser(ctx, user)
+	require.NoError(t, err)
+	assert.Len(t, urls, 2)
+}
+
+func testUserListing(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := openClosed(t, open)
+	user, other := "u"+suffix(), "u"+suffix()
+
+	var want []database.URLResponse
+	for i := 0; i < 2; i++ {
+		id, long := "l"+suffix(), "https://list.example/"+suffix()
+		_, err := s.Store(ctx, id, long, user, 0)
+		require.NoError(t, err)
+		want = append(want, database.URLResponse{ShortURL: id, OriginalURL: long})
+	}
+	_, err := s.Store(ctx, "l"+suffix(), "https://list.example/"+suffix(), other, 0)
+	require.NoError(t, err)
+
+	got, err := s.GetURLsByUser(ctx, user)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, want, got)
+
+	got, err = s.GetURLsByUser(ctx, "u"+suffix())
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func testSoftDelete(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := openClosed(t, open)
+	user := "u" + suffix()
+	id, kept := "s"+suffix(), "s"+suffix()
+
+	_, err := s.Store(ctx, id, "https://delete.example/"+suffix(), user, 0)
+	require.NoError(t, err)
+	_, err = s.Store(ctx, kept, "https://delete.example/"+suffix(), user, 0)
+	require.NoError(t, err)
+
+	// Links of other users are not affected, which is not an error: the
+	// deletion queue would retry it in vain
+	require.NoError(t, s.DeleteURLs(ctx, "u"+suffix(), []string{id}))
+	_, err = s.Get(ctx, id)
+	require.NoError(t, err)
+
+	require.NoError(t, s.DeleteURLs(ctx, user, []string{id}))
+	_, err = s.Get(ctx, id)
+	assert.ErrorIs(t, err, storage.ErrDeleted)
+	require.NoError(t, s.DeleteURLs(ctx, user, []string{id}), "deleting again is a no-op")
+
+	_, err = s.Get(ctx, kept)
+	require.NoError(t, err)
+
+	// Deleted links are left out of the listing
+	urls, err := s.GetURLsByUser(ctx, user)
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, kept, urls[0].ShortURL)
+}
+
+func testRestore(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := openClosed(t, open)
+	user := "u" + suffix()
+	first, second := "t"+suffix(), "t"+suffix()
+	firstURL := "https://trash.example/" + suffix()
+
+	_, err := s.Store(ctx, first, firstURL, user, 0)
+	require.NoError(t, err)
+	_, err = s.Store(ctx, second, "https://trash.example/"+suffix(), user, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteURLs(ctx, user, []string{first}))
+	require.NoError(t, s.DeleteURLs(ctx, user, []string{second}))
+
+	trash, err := s.GetDeletedURLsByUser(ctx, user, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, trash, 2)
+	assert.Equal(t, second, trash[0].ShortURL, "most recently deleted first")
+	assert.Equal(t, first, trash[1].ShortURL)
+	assert.Equal(t, firstURL, trash[1].OriginalURL)
+	assert.WithinDuration(t, time.Now(), trash[1].DeletedAt, time.Minute)
+
+	trash, err = s.GetDeletedURLsByUser(ctx, "u"+suffix(), time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, trash)
+
+	// Links deleted before the cutoff are past restoring
+	restored, err := s.RestoreURLs(ctx, user, []string{first}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, restored)
+
+	// Only deleted links of the user are restored
+	restored, err = s.RestoreURLs(ctx, "u"+suffix(), []string{first}, time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, restored)
+	restored, err = s.RestoreURLs(ctx, user, []string{first, "t" + suffix()}, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{first}, restored)
+
+	got, err := s.Get(ctx, first)
+	require.NoError(t, err)
+	assert.Equal(t, firstURL, got.OriginalURL)
+	urls, err := s.GetURLsByUser(ctx, user)
+	require.NoError(t, err)
+	assert.Equal(t, []database.URLResponse{{ShortURL: first, OriginalURL: firstURL}}, urls)
+
+	trash, err = s.GetDeletedURLsByUser(ctx, user, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	assert.Equal(t, second, trash[0].ShortURL)
+}
+
+func testPurge(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := openClosed(t, open)
+	user := "u" + suffix()
+	id, kept := "p"+suffix(), "p"+suffix()
+	long := "https://purge.example/" + suffix()
+
+	_, err := s.Store(ctx, id, long, user, 0)
+	require.NoError(t, err)
+	_, err = s.Store(ctx, kept, "https://purge.example/"+suffix(), user, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteURLs(ctx, user, []string{id}))
+
+	// The link was deleted just now, not an hour ago
+	_, err = s.Purge(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	_, err = s.Get(ctx, id)
+	assert.ErrorIs(t, err, storage.ErrDeleted)
+
+	n, err := s.Purge(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, n, 1)
+	_, err = s.Get(ctx, id)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.Get(ctx, kept)
+	require.NoError(t, err)
+
+	// The purged URL can be shortened again
+	_, err = s.Store(ctx, "p"+suffix(), long, user, 0)
+	assert.NoError(t, err)
+}
+
+func testRestartPersistence(t *testing.T, open Opener) {
+	ctx := context.Background()
+	user := "u" + suffix()
+	id, long := "r"+suffix(), "https://restart.example/"+suffix()
+	gone, purged, back := "r"+suffix(), "r"+suffix(), "r"+suffix()
+	batch := []database.RequestData{
+		{ID: "r" + suffix(), URL: "https://restart.example/" + suffix(), UserID: user},
+	}
+
+	s := open(t)
+	_, err := s.Store(ctx, id, long, user, 0)
+	require.NoError(t, err)
+	_, err = s.Store(ctx, gone, "https://restart.example/"+suffix(), user, 0)
+	require.NoError(t, err)
+	_, err = s.StoreBatch(ctx, batch)
+	require.NoError(t, err)
+	_, err = s.Store(ctx, purged, "https://restart.example/"+suffix(), user, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteURLs(ctx, user, []string{purged}))
+	_, err = s.Purge(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteURLs(ctx, user, []string{gone}))
+	_, err = s.Store(ctx, back, "https://restart.example/"+suffix(), user, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteURLs(ctx, user, []string{back}))
+	_, err = s.RestoreURLs(ctx, user, []string{back}, time.Time{})
+	require.NoError(t, err)
+	require.NoError(t, s.SetRedirect(ctx, user, id, 308))
+	require.NoError(t, s.Close())
+
+	s = openClosed(t, open)
+	got, err := s.Get(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, long, got.OriginalURL)
+	assert.Equal(t, 308, got.Redirect, "redirect changes must survive a restart")
+
+	storedID, err := s.Store(ctx, "r"+suffix(), long, user, 0)
+	assert.ErrorIs(t, err, storage.ErrConflict)
+	assert.Equal(t, id, storedID)
+
+	_, err = s.Get(ctx, gone)
+	assert.ErrorIs(t, err, storage.ErrDeleted, "deletions must survive a restart")
+	trash, err := s.GetDeletedURLsByUser(ctx, user, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	assert.Equal(t, gone, trash[0].ShortURL)
+	_, err = s.Get(ctx, purged)
+	assert.ErrorIs(t, err, storage.ErrNotFound, "purges must survive a restart")
+
+	urls, err := s.GetURLsByUser(ctx, user)
+	require.NoError(t, err)
+	ids := make([]string, 0, len(urls))
+	for _, u := range urls {
+		ids = append(ids, u.ShortURL)
+	}
+	want := []string{id, batch[0].ID, back}
+	sort.Strings(ids)
+	sort.Strings(want)
+	assert.Equal(t, want, ids)
+}
+
+// testConcurrentSameURL stores one URL of one user under different IDs at
+// once: exactly one store succeeds and every other returns its ID.
+func testConcurrentSameURL(t *testing.T, open Opener) {
+	const workers = 16
+
+	ctx := context.Background()
+	s := openClosed(t, open)
+	user, long := "u"+suffix(), "https://shared.example/"+suffix()
+
+	var wg sync.WaitGroup
+	ids := make([]string, workers)
+	created := make([]bool, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			id, err := s.Store(ctx, "x"+suffix(), long, user, 0)
+			if !errors.Is(err, storage.ErrConflict) {
+				assert.NoError(t, err)
+			}
+			ids[w], created[w] = id, err == nil
+		}(w)
+	}
+	wg.Wait()
+
+	winners := 0
+	for w := range ids {
+		assert.Equal(t, ids[0], ids[w], "concurrent stores of one URL must agree on its ID")
+		if created[w] {
+			winners++
+		}
+	}
+	assert.Equal(t, 1, winners)
+}
+
+// testConcurrent is meant to be run with -race.
+func testConcurrent(t *testing.T, open Opener) {
+	const workers = 16
+	const perWorker = 50
+
+	ctx := context.Background()
+	s := openClosed(t, open)
+	user := "u" + suffix()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < perWorker; i++ {
+				id, long := "x"+suffix(), "https://concurrent.example/"+suffix()
+				_, err := s.Store(ctx, id, long, user, 0)
+				if !assert.NoError(t, err) {
+					return
+				}
+				got, err := s.Get(ctx, id)
+				assert.NoError(t, err)
+				assert.Equal(t, long, got.OriginalURL)
+
+				pair := database.RequestData{ID: "x" + suffix(), URL: long + "/batch", UserID: user}
+				_, err = s.StoreBatch(ctx, []database.RequestData{pair})
+				assert.NoError(t, err)
+				_, err = s.Get(ctx, pair.ID)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	urls, err := s.GetURLsByUser(ctx, user)
+	require.NoError(t, err)
+	assert.Len(t, urls, 2*workers*perWorker)
+}
+
+func testExportImport(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := openClosed(t, open)
+	user := "u" + suffix()
+	kept, gone := "e"+suffix(), "e"+suffix()
+
+	_, err := s.Store(ctx, kept, "https://export.example/"+suffix(), user, 301)
+	require.NoError(t, err)
+	_, err = s.Store(ctx, gone, "https://export.example/"+suffix(), user, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteURLs(ctx, user, []string{gone}))
+
+	var exported []storage.Record
+	err = s.Export(ctx, func(r storage.Record) error {
+		if r.UserID == user {
+			exported = append(exported, r)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, exported, 2)
+	for _, r := range exported {
+		assert.Equal(t, r.ShortURL == gone, r.Deleted)
+		assert.WithinDuration(t, time.Now(), r.CreatedAt, time.Minute)
+	}
+
+	// Import under new IDs and owner, as if into another deployment
+	importer := "u" + suffix()
+	imported := make([]storage.Record, len(exported))
+	for i, r := range exported {
+		r.ShortURL = "i" + suffix()
+		r.UserID = importer
+		r.CreatedAt = time.Date(2024, 9, 26, 14, 46, 13, 0, time.UTC)
+		imported[i] = r
+	}
+	require.NoError(t, s.Import(ctx, imported))
+
+	for _, r := range imported {
+		got, err := s.Get(ctx, r.ShortURL)
+		if r.Deleted {
+			assert.ErrorIs(t, err, storage.ErrDeleted)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, r.OriginalURL, got.OriginalURL)
+		assert.Equal(t, 301, got.Redirect)
+	}
+
+	var reexported []storage.Record
+	err = s.Export(ctx, func(r storage.Record) error {
+		if r.UserID == importer {
+			reexported = append(reexported, r)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, reexported, len(imported))
+	for _, r := range reexported {
+		assert.True(t, imported[0].CreatedAt.Equal(r.CreatedAt), "created_at must be preserved, got %v", r.CreatedAt)
+	}
+}
@@ -0,0 +1,211 @@
+// Package transfer streams links between a storage and a portable NDJSON or
+// CSV file, so that deployments can move between backends without changing
+// short IDs.
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/vkobazev/goShortenerUrl/internal/config"
+	"github.com/vkobazev/goShortenerUrl/internal/storage"
+)
+
+// Format is the encoding of an export file.
+type Format string
+
+const (
+	// NDJSON writes one JSON record per line.
+	NDJSON Format = "ndjson"
+	// CSV writes a header row followed by one row per record.
+	CSV Format = "csv"
+)
+
+// ImportBatchSize is how many records Import stores at once.
+const ImportBatchSize = 1000
+
+var csvHeader = []string{"short_url", "original_url", "user_id", "deleted", "created_at", "redirect"}
+
+// legacyCSVColumns is the number of columns of files exported before links
+// had a redirect status.
+const legacyCSVColumns = 5
+
+func ParseFormat(s string) (Format, error) {
+	switch format := Format(s); format {
+	case NDJSON, CSV:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown export format %q, want ndjson or csv", s)
+	}
+}
+
+// Export writes every link of s to w and returns how many were written.
+func Export(ctx context.Context, s storage.Storage, w io.Writer, format Format) (int, error) {
+	bw := bufio.NewWriter(w)
+	write, flush, err := newWriter(bw, format)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	err = s.Export(ctx, func(r storage.Record) error {
+		n++
+		return write(r)
+	})
+	if err != nil {
+		return n, err
+	}
+	if err := flush(); err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+// Import stores every record read from r in s and returns how many were
+// stored.
+func Import(ctx context.Context, s storage.Storage, r io.Reader, format Format) (int, error) {
+	read, err := newReader(r, format)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	batch := make([]storage.Record, 0, ImportBatchSize)
+	for {
+		record, err := read()
+		if err == io.EOF {
+			break
+		}
+		if err == nil && (record.ShortURL == "" || record.OriginalURL == "") {
+			err = fmt.Errorf("short_url and original_url are required")
+		}
+		if err == nil && record.Redirect != 0 && !config.ValidRedirect(record.Redirect) {
+			err = fmt.Errorf("redirect must be 301, 302, 307 or 308, or 0 for the default, got %d", record.Redirect)
+		}
+		if err != nil {
+			return n, fmt.Errorf("record %d: %w", n+len(batch)+1, err)
+		}
+
+		batch = append(batch, record)
+		if len(batch) == ImportBatchSize {
+			if err := s.Import(ctx, batch); err != nil {
+				return n, err
+			}
+			n += len(batch)
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		if err := s.Import(ctx, batch); err != nil {
+			return n, err
+		}
+		n += len(batch)
+	}
+	return n, nil
+}
+
+func newWriter(w io.Writer, format Format) (write func(storage.Record) error, flush func() error, err error) {
+	switch format {
+	case NDJSON:
+		enc := json.NewEncoder(w)
+		return func(r storage.Record) error { return enc.Encode(r) },
+			func() error { return nil }, nil
+	case CSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return nil, nil, err
+		}
+		write = func(r storage.Record) error {
+			createdAt := ""
+			if !r.CreatedAt.IsZero() {
+				createdAt = r.CreatedAt.Format(time.RFC3339Nano)
+			}
+			return cw.Write([]string{r.ShortURL, r.OriginalURL, r.UserID, strconv.FormatBool(r.Deleted), createdAt, strconv.Itoa(r.Redirect)})
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+		return write, flush, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+func newReader(r io.Reader, format Format) (func() (storage.Record, error), error) {
+	switch format {
+	case NDJSON:
+		dec := json.NewDecoder(r)
+		return func() (storage.Record, error) {
+			var record storage.Record
+			err := dec.Decode(&record)
+			return record, err
+		}, nil
+	case CSV:
+		// Every row must have as many fields as the header
+		cr := csv.NewReader(r)
+		header, err := cr.Read()
+		if err == io.EOF {
+			return func() (storage.Record, error) { return storage.Record{}, io.EOF }, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(header) != len(csvHeader) && len(header) != legacyCSVColumns {
+			return nil, fmt.Errorf("unexpected CSV header %v, want %v", header, csvHeader)
+		}
+		for i, name := range header {
+			if csvHeader[i] != name {
+				return nil, fmt.Errorf("unexpected CSV header %v, want %v", header, csvHeader)
+			}
+		}
+		return func() (storage.Record, error) {
+			row, err := cr.Read()
+			if err != nil {
+				return storage.Record{}, err
+			}
+			return parseRow(row)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+func parseRow(row []string) (storage.Record, error) {
+	record := storage.Record{
+		ShortURL:    row[0],
+		OriginalURL: row[1],
+		UserID:      row[2],
+	}
+
+	deleted, err := strconv.ParseBool(row[3])
+	if err != nil {
+		return storage.Record{}, fmt.Errorf("deleted: %w", err)
+	}
+	record.Deleted = deleted
+
+	if row[4] != "" {
+		createdAt, err := time.Parse(time.RFC3339Nano, row[4])
+		if err != nil {
+			return storage.Record{}, fmt.Errorf("created_at: %w", err)
+		}
+		record.CreatedAt = createdAt
+	}
+
+	// Files without the column keep the server default
+	if len(row) > legacyCSVColumns && row[5] != "" {
+		redirect, err := strconv.Atoi(row[5])
+		if err != nil {
+			return storage.Record{}, fmt.Errorf("redirect: %w", err)
+		}
+		record.Redirect = redirect
+	}
+	return record, nil
+}
@@ -0,0 +1,85 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vkobazev/goShortenerUrl/internal/data"
+	"github.com/vkobazev/goShortenerUrl/internal/storage"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	want := []storage.Record{
+		{ShortURL: "abc123", OriginalURL: "https://a.example/?q=1,2", UserID: "u1", CreatedAt: time.Date(2024, 9, 26, 14, 46, 13, 5, time.UTC), Redirect: 308},
+		{ShortURL: "def456", OriginalURL: "https://b.example", UserID: "u2", Deleted: true},
+	}
+
+	for _, format := range []Format{NDJSON, CSV} {
+		t.Run(string(format), func(t *testing.T) {
+			src := storage.NewMemory()
+			require.NoError(t, src.Import(ctx, want))
+
+			var buf bytes.Buffer
+			n, err := Export(ctx, src, &buf, format)
+			require.NoError(t, err)
+			assert.Equal(t, len(want), n)
+
+			// Move the links into file storage, as when upgrading a deployment
+			dst, err := storage.NewFile(filepath.Join(t.TempDir(), "data.json"), data.Options{})
+			require.NoError(t, err)
+			defer dst.Close()
+
+			n, err = Import(ctx, dst, &buf, format)
+			require.NoError(t, err)
+			assert.Equal(t, len(want), n)
+
+			var got []storage.Record
+			require.NoError(t, dst.Export(ctx, func(r storage.Record) error {
+				got = append(got, r)
+				return nil
+			}))
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := Import(ctx, storage.NewMemory(), strings.NewReader("id,url\n"), CSV)
+	assert.Error(t, err, "unexpected header")
+
+	_, err = Import(ctx, storage.NewMemory(), strings.NewReader(`{"user_id":"u1"}`), NDJSON)
+	assert.Error(t, err, "missing short_url")
+
+	_, err = Import(ctx, storage.NewMemory(), strings.NewReader(`{"short_url":"a","original_url":"https://a","redirect":303}`), NDJSON)
+	assert.Error(t, err, "invalid redirect")
+
+	_, err = Import(ctx, storage.NewMemory(), strings.NewReader("short_url,original_url,user_id,deleted,created_at,redirect\na,https://a,u1,false,,200\n"), CSV)
+	assert.Error(t, err, "invalid redirect")
+
+	n, err := Import(ctx, storage.NewMemory(), strings.NewReader(""), CSV)
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestImportLegacyCSV(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemory()
+
+	// Exported before links had a redirect status
+	n, err := Import(ctx, s, strings.NewReader("short_url,original_url,user_id,deleted,created_at\nabc,https://a.example,u1,false,\n"), CSV)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	link, err := s.Get(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, storage.Link{OriginalURL: "https://a.example"}, link)
+}
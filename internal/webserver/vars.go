@@ -0,0 +1,37 @@
+package webserver
+
+import (
+	"expvar"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// publicVars are the expvar variables served at /debug/vars. The stock
+// expvar handler also serves cmdline and memstats, and the command line
+// holds the database DSN with its password.
+var publicVars = []string{"redirect_cache", "id_length"}
+
+// DebugVars serves the published publicVars in the format of the expvar
+// handler.
+func DebugVars(c echo.Context) error {
+	var b strings.Builder
+	b.WriteString("{\n")
+	first := true
+	for _, name := range publicVars {
+		v := expvar.Get(name)
+		if v == nil {
+			continue
+		}
+		if !first {
+			b.WriteString(",\n")
+		}
+		first = false
+		b.WriteString(strconv.Quote(name))
+		b.WriteString(": ")
+		b.WriteString(v.String())
+	}
+	b.WriteString("\n}\n")
+	return c.Blob(http.StatusOK, "application/json; charset=utf-8", []byte(b.String()))
+}
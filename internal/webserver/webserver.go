@@ -2,32 +2,79 @@ package webserver
 
 import (
 	"context"
+	"expvar"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/vkobazev/goShortenerUrl/internal/config"
-	"github.com/vkobazev/goShortenerUrl/internal/data"
 	"github.com/vkobazev/goShortenerUrl/internal/database"
+	"github.com/vkobazev/goShortenerUrl/internal/deletion"
 	"github.com/vkobazev/goShortenerUrl/internal/handlers"
+	"github.com/vkobazev/goShortenerUrl/internal/idgen"
 	"github.com/vkobazev/goShortenerUrl/internal/jwt"
 	"github.com/vkobazev/goShortenerUrl/internal/logger"
+	"github.com/vkobazev/goShortenerUrl/internal/storage"
 	"go.uber.org/zap"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func StartWebServer() {
-	// Create New map for Short links list
-	sh := handlers.NewShortList()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	if config.Options.DataBaseConn != "" {
-		InitDB(sh)
-		defer sh.DB.Close()
-	} else {
-		SetupEvents(sh)
-		defer data.P.Close()
+	// Select storage backend once at startup
+	s := SetupStorage()
+	l := SetupLogger()
+	q := SetupDeletions(s, l)
+	j := deletion.NewJanitor(s, config.Options.PurgeAfter, config.Options.PurgeInterval, l)
+	sh := handlers.NewShortList(s, q, l)
+	sh.IDs = SetupIDs(s)
+	sh.Filter = SetupFilter()
+	e := SetupEcho(l, sh)
+
+	failed := make(chan error, 1)
+	go func() {
+		failed <- e.Start(config.Options.ListenAddr)
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		l.Info("Shutting down")
+	case err = <-failed:
+		l.Error("Server stopped", zap.Error(err))
 	}
+	// A second signal kills the process right away
+	stop()
 
-	l := SetupLogger()
-	SetupEcho(l, sh)
+	Shutdown(e, q, j, s, l, config.Options.ShutdownTimeout)
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// Shutdown stops accepting connections, waits for requests in flight and
+// queued deletions until timeout, stops the janitor, then closes the
+// storage, flushing the event file or the connection pool.
+func Shutdown(e *echo.Echo, q *deletion.Queue, j *deletion.Janitor, s storage.Storage, l *zap.Logger, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := e.Shutdown(ctx); err != nil {
+		l.Error("Failed to drain HTTP requests", zap.Error(err))
+	}
+	if err := q.Close(ctx); err != nil {
+		l.Error("Failed to drain deletion queue, the rest is resumed on next start", zap.Error(err))
+	}
+	j.Close()
+	if err := s.Close(); err != nil {
+		l.Error("Failed to close storage", zap.Error(err))
+	}
+	l.Info("Server stopped")
+	_ = l.Sync()
 }
 
 func SetupLogger() *zap.Logger {
@@ -39,29 +86,103 @@ func SetupLogger() *zap.Logger {
 	return l
 }
 
-func SetupEvents(sh *handlers.URLShortener) {
-	// New Consumer to restore data
-	C, err := data.NewConsumer(config.Options.FileStoragePath)
+// SetupDeletions starts the background deletion queue, resuming the jobs
+// left in its journal.
+func SetupDeletions(s storage.Storage, l *zap.Logger) *deletion.Queue {
+	q, err := deletion.New(s, config.Options.DeleteQueuePath, deletion.Options{}, l)
+	if err != nil {
+		log.Fatalf("failed to start deletion queue: %s", err)
+	}
+	return q
+}
+
+// SetupIDs returns the configured short ID generator. Counter based
+// generators continue after the highest ID stored: purged links leave
+// fewer links than IDs made, and starting at their number would propose
+// taken IDs until the counter caught up.
+func SetupIDs(s storage.Storage) idgen.IDGenerator {
+	ctx := context.Background()
+	strategy, err := idgen.ParseStrategy(config.Options.IDGenerator)
 	if err != nil {
-		log.Fatalf("Error creating consumer for Events: %v", err)
+		log.Fatalf("failed to set up ID generator: %s", err)
 	}
-	events, err := C.ReadAllEvents()
+	n, err := s.Count(ctx)
 	if err != nil {
-		log.Fatalf("Error restore DATA from Events: %v", err)
+		log.Fatalf("failed to count stored URLs: %s", err)
+	}
+	ids, err := idgen.New(strategy, idgen.Options{
+		Length:   config.Options.IDLength,
+		Alphabet: config.IDAlphabet(),
+		Salt:     config.Options.IDSalt,
+		Start:    uint64(n),
+		GrowAt:   config.Options.IDGrowAt,
+	})
+	if err != nil {
+		log.Fatalf("failed to set up ID generator: %s", err)
+	}
+	if r, ok := ids.(idgen.Resumer); ok {
+		err := s.Export(ctx, func(rec storage.Record) error {
+			r.Resume(rec.ShortURL)
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("failed to read stored IDs: %s", err)
+		}
+	}
+	if g, ok := ids.(*idgen.Growing); ok {
+		expvar.Publish("id_length", expvar.Func(func() any {
+			return g.Length()
+		}))
 	}
-	for _, event := range events {
-		sh.URLS[event.Short] = event.Long
-		sh.Counter = event.ID
+	return ids
+}
+
+// SetupFilter loads the words kept out of short IDs and aliases.
+func SetupFilter() *idgen.Filter {
+	f, err := idgen.LoadFilter(config.Options.IDBlocklist)
+	if err != nil {
+		log.Fatalf("failed to load ID blocklist: %s", err)
+	}
+	return f
+}
+
+func SetupStorage() storage.Storage {
+	switch {
+	case config.Options.DataBaseConn != "":
+		return SetupCache(InitDB())
+	case config.Options.SQLitePath != "":
+		return SetupCache(InitSQLite())
+	default:
+		return SetupEvents()
 	}
+}
+
+// SetupCache puts the redirect cache in front of a database backend and
+// publishes its counters at /debug/vars.
+func SetupCache(s storage.Storage) storage.Storage {
+	if config.Options.CacheSize <= 0 {
+		return s
+	}
+	c := storage.NewCached(s, config.Options.CacheSize, config.Options.CacheTTL)
+	expvar.Publish("redirect_cache", expvar.Func(func() any {
+		return c.Stats()
+	}))
+	return c
+}
 
-	// New Event producer
-	data.P, err = data.NewProducer(config.Options.FileStoragePath)
+func SetupEvents() storage.Storage {
+	// Restore data from Events and open new Event producer
+	s, err := storage.NewFile(config.Options.FileStoragePath, config.FileOptions())
 	if err != nil {
-		panic(err)
+		log.Fatalf("Error restore DATA from Events: %v", err)
+	}
+	if config.Options.SnapshotInterval > 0 {
+		s.CompactEvery(config.Options.SnapshotInterval)
 	}
+	return s
 }
 
-func SetupEcho(l *zap.Logger, sh *handlers.URLShortener) {
+func SetupEcho(l *zap.Logger, sh *handlers.URLShortener) *echo.Echo {
 	e := echo.New()
 	// Add middleware
 	e.Use(middleware.Logger())
@@ -78,6 +199,7 @@ func SetupEcho(l *zap.Logger, sh *handlers.URLShortener) {
 		g.POST("", sh.CreateShortURL)
 		g.GET(":id", sh.GetLongURL)
 		g.GET("ping", sh.PingDB)
+		g.GET("debug/vars", DebugVars)
 
 		// Define api group
 		api := g.Group("api/")
@@ -88,25 +210,49 @@ func SetupEcho(l *zap.Logger, sh *handlers.URLShortener) {
 			user := api.Group("user/")
 			{
 				user.GET("urls", sh.APIReturnUserData)
+				user.PATCH("urls/:id", sh.APIUpdateUserURL)
 				user.DELETE("urls", sh.APIDeleteUserURLs)
+				user.GET("urls/delete/:job", sh.APIDeleteStatus)
+				user.GET("urls/trash", sh.APIReturnUserTrash)
+				user.POST("urls/restore", sh.APIRestoreUserURLs)
 			}
 		}
 	}
 
-	e.Logger.Fatal(e.Start(config.Options.ListenAddr))
+	// Links must not be shadowed by the routes above
+	for _, r := range e.Routes() {
+		sh.Reserve(r.Path)
+	}
+
+	return e
 }
 
-func InitDB(sh *handlers.URLShortener) {
+func InitDB() storage.Storage {
 	// Init DB
-	var err error
-
-	sh.DB, err = database.New(config.Options.DataBaseConn)
+	db, err := database.New(config.Options.DataBaseConn)
 	if err != nil {
 		log.Fatalf("Error connecting to database: %v", err)
 	}
 
-	err = sh.DB.CreateTable(context.Background())
+	err = db.MigrateUp(context.Background())
+	if err != nil {
+		log.Fatalf("Error migrating database: %v", err)
+	}
+	db.SetQueryTimeout(config.Options.QueryTimeout)
+	return storage.NewDatabase(db)
+}
+
+func InitSQLite() storage.Storage {
+	// Init embedded SQLite
+	db, err := database.NewSQLite(config.Options.SQLitePath)
+	if err != nil {
+		log.Fatalf("Error opening SQLite database: %v", err)
+	}
+
+	err = db.CreateTable(context.Background())
 	if err != nil {
 		log.Fatalf("Error creating table: %v", err)
 	}
+	db.SetQueryTimeout(config.Options.QueryTimeout)
+	return storage.NewDatabase(db)
 }